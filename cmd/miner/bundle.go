@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/bundle"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// runBundle handles `miner bundle create`, which packs this Miner binary, the
+// FrankenPHP binary in use and the assets into a tarball for machines without
+// internet access
+func runBundle(args []string, logger *slog.Logger) error {
+	usage := fmt.Errorf("usage: miner bundle create [-o <file>]")
+	if len(args) < 1 || args[0] != "create" {
+		return usage
+	}
+	fs := flag.NewFlagSet("bundle create", flag.ContinueOnError)
+	out := fs.String("o", "", "tarball to write (default miner-<version>-<os>-<arch>.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: miner bundle create [-o <file>]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usage
+	}
+
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+	return createBundle(cfg, *out)
+}
+
+// createBundle writes the offline bundle to out. Its files sit below a
+// miner-<version>-<os>-<arch> directory, with FrankenPHP laid out as a
+// mirror (frankenphp/v<version>/<asset>) and a SHA256SUMS of both binaries.
+func createBundle(cfg *config.Config, out string) error {
+	asset, err := frankenphp.Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	binary, err := config.FrankenPHPPath()
+	if err != nil {
+		return fmt.Errorf("no FrankenPHP binary to bundle; run 'miner frankenphp install %s' first", frankenphp.DefaultVersion)
+	}
+	version, err := frankenphp.Version(runner.Exec{}, binary)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("miner-%s-%s-%s", config.AppVersion, runtime.GOOS, runtime.GOARCH)
+	if out == "" {
+		out = name + ".tar.gz"
+	}
+	fphp := path.Join("frankenphp", "v"+version, asset)
+	entries := []bundle.Entry{
+		{Name: path.Join(name, "miner"), Path: cfg.BinaryPath},
+		{Name: path.Join(name, fphp), Path: binary},
+	}
+
+	var sums strings.Builder
+	var fphpSum string
+	for _, e := range entries {
+		sum, err := frankenphp.FileSHA256(e.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, strings.TrimPrefix(e.Name, name+"/"))
+		fphpSum = sum // the last entry
+	}
+	assetEntries, err := bundle.Dir(cfg.AssetsDir, path.Join(name, "assets"))
+	if err != nil {
+		return fmt.Errorf("failed to read assets: %w", err)
+	}
+	entries = append(entries, assetEntries...)
+	entries = append(entries, bundle.Entry{Name: path.Join(name, "SHA256SUMS"), Data: []byte(sums.String())})
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = bundle.Write(f, entries)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+
+	fmt.Printf("✓ Bundled Miner %s, FrankenPHP %s and assets into %s\n", config.AppVersion, version, out)
+	fmt.Println()
+	fmt.Println("On the offline machine, run:")
+	fmt.Printf("  tar xzf %s && cd %s\n", path.Base(out), name)
+	install := "  sudo ./miner install --frankenphp-from frankenphp"
+	if frankenphp.PinnedChecksums()[version+"/"+asset] != fphpSum {
+		// Not a release Miner can verify itself; vouch for this copy
+		install += " --frankenphp-sha256 " + fphpSum
+	}
+	fmt.Println(install)
+	return nil
+}
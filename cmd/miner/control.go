@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/control"
+	"github.com/4nkitd/miner/internal/instance"
+	"github.com/4nkitd/miner/internal/systray"
+)
+
+// runControl sends start, stop, restart or reload to the running instance.
+func runControl(action string) error {
+	client, err := config.DialInstance()
+	if errors.Is(err, control.ErrNoInstance) {
+		return fmt.Errorf("no running Miner instance; start one with 'miner' or 'miner daemon'")
+	}
+	if err != nil {
+		return err
+	}
+
+	var st *control.Status
+	switch action {
+	case "start":
+		st, err = client.Start()
+	case "stop":
+		st, err = client.Stop()
+	case "restart":
+		st, err = client.Restart()
+	case "reload":
+		st, err = client.Reload()
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", action, err)
+	}
+
+	fmt.Printf("✓ Server %s (%s, pid %d)\n", st.State, st.Mode, st.PID)
+	if st.State == "running" {
+		fmt.Printf("  %s\n", st.URL)
+	}
+	return nil
+}
+
+// runAttached runs the tray for an instance owned by another process,
+// controlling it through its control socket and leaving it running on quit.
+func runAttached(cfg *config.Config, locked *instance.LockedError, logger *slog.Logger) error {
+	client, err := config.DialInstance()
+	if err != nil {
+		logger.Debug("cannot attach to running instance", "err", err)
+		return fmt.Errorf("%w; control it with 'sudo miner stop' or open Adminer with 'miner open'", locked)
+	}
+
+	remote := control.NewRemote(client)
+	user := userInstalled(cfg, logger)
+	_, svc, err := newManagers(cfg, user, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	u := &uninstaller{cfg: cfg, opts: &installOptions{yes: true, user: user}, logger: logger}
+	app := systray.NewApp(remote, u, svc, cfg, logger.With("component", "tray"))
+	app.SetOwnsServer(false)
+
+	fmt.Printf("Attached to the running Miner instance (%s). Check system tray for menu.\n", locked.Owner)
+	fmt.Printf("Access Adminer at: %s\n", remote.URL())
+	app.Run()
+	return nil
+}
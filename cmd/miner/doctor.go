@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/cli"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/elevation"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// checkLevel is the outcome of a doctor check
+type checkLevel string
+
+const (
+	checkPass checkLevel = "pass"
+	checkWarn checkLevel = "warn"
+	checkFail checkLevel = "fail"
+)
+
+// check is one doctor diagnostic
+type check struct {
+	name   string
+	level  checkLevel
+	detail string
+	remedy string       // how to repair it by hand; shown unless the check passes
+	fix    func() error // repairs the problem (needs elevation); nil if --fix cannot
+}
+
+// runDoctor implements `miner doctor [--fix]`.
+func runDoctor(args []string, logger *slog.Logger) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "Repair the checks that fail or warn (requires admin/root)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: miner doctor [--fix]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		printCheck(check{
+			name:   "Configuration",
+			level:  checkFail,
+			detail: err.Error(),
+			remedy: fmt.Sprintf("Correct or remove the offending file (%s)", strings.Join(config.ConfigFiles(), ", ")),
+		})
+		return fmt.Errorf("configuration could not be loaded")
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+
+	user := userInstalled(cfg, logger)
+	manifestFile := config.SystemManifestFile()
+	if user {
+		manifestFile = config.ManifestFile()
+	}
+	// Repairs are recorded like install steps, so that uninstall reverts them
+	record, err := manifest.Open(manifestFile, config.AppVersion, scopeName(user))
+	if err != nil {
+		return err
+	}
+	checks := runChecks(cfg, user, record, logger)
+	for _, c := range checks {
+		printCheck(c)
+	}
+
+	var fixable, failed, warned int
+	for _, c := range checks {
+		if c.level != checkPass && c.fix != nil {
+			fixable++
+		}
+		switch c.level {
+		case checkFail:
+			failed++
+		case checkWarn:
+			warned++
+		}
+	}
+
+	if !*fix {
+		fmt.Println()
+		if failed+warned == 0 {
+			fmt.Println("✓ No problems found")
+			return nil
+		}
+		if fixable > 0 {
+			fixCommand := "sudo miner doctor --fix"
+			if user {
+				fixCommand = "miner doctor --fix"
+			}
+			fmt.Printf("%d problem(s) can be repaired with: %s\n", fixable, fixCommand)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	}
+
+	if fixable == 0 {
+		fmt.Println()
+		fmt.Println("Nothing to repair automatically.")
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	}
+	// A per-user install elevates only for the hosts entry fix
+	if !user && !elevation.IsElevated() {
+		fmt.Println()
+		fmt.Println("Repairing Miner requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
+	}
+
+	fmt.Println()
+	failed = 0
+	for _, c := range checks {
+		if c.level == checkPass || c.fix == nil {
+			if c.level == checkFail {
+				failed++
+			}
+			continue
+		}
+		fmt.Printf("✓ Repairing %s\n", strings.ToLower(c.name))
+		if err := c.fix(); err != nil {
+			fmt.Printf("  Warning: %v\n", err)
+			failed++
+		}
+	}
+	if err := record.Save(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d problem(s) remain; run 'miner doctor' for details", failed)
+	}
+	fmt.Println()
+	fmt.Println("✓ Repairs complete!")
+	return nil
+}
+
+// runChecks inspects each component installed by `miner install`, or by
+// `miner install --user` when user is set
+func runChecks(cfg *config.Config, user bool, record *manifest.Manifest, logger *slog.Logger) []check {
+	hostsManager := hosts.NewManager(cfg.HostsPath, logger)
+	cliManager, svc, err := newManagers(cfg, user, logger)
+	if err != nil {
+		return []check{{name: "Configuration", level: checkFail, detail: err.Error()}}
+	}
+	cliManager.SetRecorder(record)
+	return []check{
+		checkHosts(cfg, hostsManager, user, record),
+		checkWrappers(cliManager, user),
+		checkPath(cliManager),
+		checkFrankenPHP(cfg, user, record, logger),
+		checkService(svc, user, record),
+		checkAssets(cfg),
+	}
+}
+
+func checkHosts(cfg *config.Config, m *hosts.Manager, user bool, record *manifest.Manifest) check {
+	c := check{name: "Hosts entry"}
+	domains := cfg.HostsDomains()
+	if len(domains) == 0 {
+		c.level, c.detail = checkPass, fmt.Sprintf("not needed for %s", strings.Join(cfg.Domains(), ", "))
+		return c
+	}
+
+	// Mappings outside Miner's block come first and would shadow a fix
+	var ok, problems, broken []string
+	shadowed := false
+	for _, domain := range domains {
+		mappings, err := m.Mappings(domain)
+		if err != nil {
+			c.level, c.detail = checkFail, err.Error()
+			c.remedy = fmt.Sprintf("Make sure %s exists and is readable", cfg.HostsPath)
+			return c
+		}
+		fixable := false
+		for _, ip := range cfg.HostIPs() {
+			got, found := hosts.Resolve(mappings, ip)
+			switch {
+			case !found:
+				problems = append(problems, fmt.Sprintf("%s -> %s missing", domain, ip))
+				fixable = true
+			case !net.ParseIP(got.IP).Equal(net.ParseIP(ip)):
+				problems = append(problems, fmt.Sprintf("%s points at %s instead of %s", domain, got.IP, ip))
+				if got.Managed {
+					fixable = true
+				} else {
+					shadowed = true
+				}
+			case got.Managed:
+				ok = append(ok, fmt.Sprintf("%s -> %s", domain, got.IP))
+			default:
+				ok = append(ok, fmt.Sprintf("%s -> %s (not managed by Miner)", domain, got.IP))
+			}
+		}
+		if fixable {
+			broken = append(broken, domain)
+		}
+	}
+
+	if len(problems) == 0 {
+		c.level, c.detail = checkPass, strings.Join(ok, ", ")
+		return c
+	}
+	c.level, c.detail = checkFail, strings.Join(problems, ", ")
+	c.remedy = fmt.Sprintf("Map %s to %s in %s", strings.Join(domains, ", "), strings.Join(cfg.HostIPs(), ", "), cfg.HostsPath)
+	if shadowed {
+		c.remedy = fmt.Sprintf("Correct or remove the lines outside the \"# BEGIN miner\" block of %s, then rerun 'miner doctor --fix'", cfg.HostsPath)
+	}
+	if len(broken) > 0 {
+		c.fix = func() error {
+			return addHostsEntries(cfg, m, broken, user, record)
+		}
+	}
+	return c
+}
+
+func checkWrappers(m *cli.Manager, user bool) check {
+	c := check{name: "CLI commands", fix: m.Register}
+	remedy := fmt.Sprintf("Run '%s --no-service --no-hosts --no-frankenphp'", installCommand(user))
+
+	var missing []string
+	for _, name := range cli.Commands {
+		if !m.Installed()[name] {
+			missing = append(missing, name)
+		}
+	}
+	switch stale := m.Stale(); {
+	case len(missing) > 0:
+		c.level, c.detail = checkFail, fmt.Sprintf("%s missing from %s", strings.Join(missing, ", "), m.BinDir())
+		c.remedy = remedy
+	case len(stale) > 0:
+		c.level, c.detail = checkWarn, fmt.Sprintf("%s in %s are outdated (was miner moved?)", strings.Join(stale, ", "), m.BinDir())
+		c.remedy = remedy
+	default:
+		c.level, c.detail, c.fix = checkPass, fmt.Sprintf("%s in %s", strings.Join(cli.Commands, ", "), m.BinDir()), nil
+	}
+	return c
+}
+
+func checkPath(m *cli.Manager) check {
+	c := check{name: "PATH"}
+	switch {
+	case !m.PathConfigured():
+		c.level, c.detail, c.fix = checkFail, m.BinDir()+" is not added to PATH for new shells", m.EnsurePath
+		c.remedy = fmt.Sprintf("Add 'export PATH=\"%s:$PATH\"' to your shell profile", m.BinDir())
+	case !m.OnPath():
+		c.level, c.detail = checkWarn, m.BinDir()+" is configured but not on the PATH of this shell"
+		c.remedy = "Open a new terminal or re-source your shell profile"
+	default:
+		c.level, c.detail = checkPass, m.BinDir()+" is on PATH"
+	}
+	return c
+}
+
+func checkFrankenPHP(cfg *config.Config, user bool, record *manifest.Manifest, logger *slog.Logger) check {
+	c := check{name: "FrankenPHP"}
+	store := frankenphpStore(cfg, user, logger)
+	path, err := config.FrankenPHPPath()
+	if err != nil {
+		c.level, c.detail = checkFail, "frankenphp not found in a managed store or PATH"
+		c.fix = func() error { return store.EnsureInstalled(record) }
+		c.remedy = fmt.Sprintf("Run '%sminer frankenphp install %s'", sudoPrefix(user), frankenphp.DefaultVersion)
+		return c
+	}
+	version, err := frankenphp.CheckVersion(runner.Exec{}, path)
+	switch {
+	case version == "" && err != nil:
+		c.level, c.detail = checkWarn, fmt.Sprintf("%s does not report its version: %v", path, err)
+		c.remedy = fmt.Sprintf("Reinstall FrankenPHP or remove the broken binary at %s", path)
+	case err != nil:
+		c.level, c.detail = checkFail, err.Error()
+		c.remedy = fmt.Sprintf("Run '%sminer frankenphp install %s' and '%[1]sminer frankenphp use %[2]s'", sudoPrefix(user), frankenphp.DefaultVersion)
+	default:
+		c.level, c.detail = checkPass, fmt.Sprintf("%s (v%s)", path, version)
+	}
+	return c
+}
+
+// sudoPrefix is prepended to commands that need root for a system-wide install
+func sudoPrefix(user bool) string {
+	if user {
+		return ""
+	}
+	return "sudo "
+}
+
+func checkService(svc *config.MinerService, user bool, record *manifest.Manifest) check {
+	c := check{name: "Auto-start service"}
+	state, err := svc.Status()
+	switch {
+	case err != nil:
+		c.level, c.detail = checkWarn, fmt.Sprintf("status unknown: %v", err)
+		c.remedy = "Check the system service manager (systemctl, launchctl or services.msc)"
+	case state == "Running":
+		c.level, c.detail = checkPass, "running"
+	case state == "Not installed":
+		// Skipped on purpose with --no-service, so only a warning
+		c.level, c.detail = checkWarn, "not installed"
+		c.remedy = fmt.Sprintf("Run '%s' or enable Auto-start on Boot in the tray menu", installCommand(user))
+		// Reinstall only a service that install put in place and something removed
+		installed := manifest.Change{Component: manifest.ComponentService, Kind: manifest.KindService, Value: scopeName(user)}
+		if record.Has(installed) {
+			c.fix = func() error {
+				if err := svc.Install(); err != nil {
+					return fmt.Errorf("failed to install service: %w", err)
+				}
+				return svc.Start()
+			}
+		}
+	default:
+		c.level, c.detail = checkWarn, strings.ToLower(state)
+		c.remedy = "Start it with your service manager or reboot"
+		c.fix = svc.Start
+	}
+	return c
+}
+
+func checkAssets(cfg *config.Config) check {
+	c := check{name: "Adminer assets"}
+	version, err := assets.AdminerVersion(cfg.AssetsDir)
+	switch {
+	case err != nil:
+		c.level, c.detail = checkFail, err.Error()
+		c.remedy = "Reinstall Miner, or place adminer.php in an assets directory next to the binary"
+	case cfg.TempAssets != "":
+		c.level, c.detail = checkPass, fmt.Sprintf("Adminer v%s (embedded copy)", version)
+	default:
+		c.level, c.detail = checkPass, fmt.Sprintf("Adminer v%s in %s", version, cfg.AssetsDir)
+	}
+	return c
+}
+
+func printCheck(c check) {
+	fmt.Printf("[%s] %s: %s\n", c.level, c.name, c.detail)
+	if c.level != checkPass && c.remedy != "" {
+		fmt.Printf("       %s\n", c.remedy)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// runFrankenPHP manages the FrankenPHP versions in Miner's store: the system
+// store when run as root, the current user's otherwise. The server and the
+// php/fphp wrappers run the version in use.
+func runFrankenPHP(args []string, logger *slog.Logger) error {
+	usage := fmt.Errorf("usage: miner frankenphp list | install [--sha256 <hex>] <version> | install [--sha256 <hex>] --from <path> | use <version> | rollback")
+	if len(args) < 1 {
+		return usage
+	}
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+	store := frankenphp.NewStore(config.FrankenPHPDir(), logger)
+	store.SetInstaller(frankenphpInstaller(cfg, logger))
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		return listFrankenPHP(store)
+	case "install":
+		fs := flag.NewFlagSet("frankenphp install", flag.ContinueOnError)
+		sum := fs.String("sha256", "", "SHA-256 of the release binary, for releases Miner has no checksum for")
+		from := fs.String("from", "", "install offline from a release binary, mirror directory or bundle tarball")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: miner frankenphp install [--sha256 <hex>] <version>\n       miner frankenphp install [--sha256 <hex>] --from <path>\n\nFlags:\n")
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		if *from != "" && fs.NArg() == 0 {
+			return installFrankenPHPFrom(store, *from, *sum)
+		}
+		if *from != "" || fs.NArg() != 1 {
+			return usage
+		}
+		return installFrankenPHP(store, cfg, fs.Arg(0), *sum, logger)
+	case "use":
+		if len(args) != 2 {
+			return usage
+		}
+		return useFrankenPHP(store, args[1])
+	case "rollback":
+		if len(args) != 1 {
+			return usage
+		}
+		previous := store.Previous()
+		if previous == "" {
+			return fmt.Errorf("no previous FrankenPHP version to roll back to")
+		}
+		return useFrankenPHP(store, previous)
+	default:
+		return usage
+	}
+}
+
+// listFrankenPHP prints the installed versions, marking the one in use
+func listFrankenPHP(store *frankenphp.Store) error {
+	versions, err := store.Versions()
+	if err != nil {
+		return err
+	}
+	current, _ := store.Current()
+	if len(versions) == 0 {
+		fmt.Printf("No FrankenPHP versions installed in %s.\n", store.Dir())
+	} else {
+		fmt.Printf("FrankenPHP versions in %s:\n", store.Dir())
+		for i := len(versions) - 1; i >= 0; i-- {
+			mark := " "
+			if versions[i] == current {
+				mark = "*"
+			}
+			fmt.Printf("  %s %s\n", mark, versions[i])
+		}
+		if previous := store.Previous(); previous != "" {
+			fmt.Printf("\nRollback target: %s\n", previous)
+		}
+	}
+
+	path, err := config.FrankenPHPPath()
+	if err != nil {
+		fmt.Printf("\nNo FrankenPHP binary found; run 'miner frankenphp install %s'\n", frankenphp.DefaultVersion)
+		return nil
+	}
+	if version, err := frankenphp.Version(runner.Exec{}, path); err == nil {
+		fmt.Printf("\nIn use: %s (v%s)\n", path, version)
+	} else {
+		fmt.Printf("\nIn use: %s\n", path)
+	}
+	return nil
+}
+
+// installFrankenPHP downloads and verifies version into the store, and puts
+// it in use if the store had none
+func installFrankenPHP(store *frankenphp.Store, cfg *config.Config, version, sum string, logger *slog.Logger) error {
+	if sum != "" {
+		installer := frankenphpInstaller(cfg, logger)
+		if err := installer.Pin(version, sum); err != nil {
+			return err
+		}
+		store.SetInstaller(installer)
+	}
+
+	fmt.Printf("✓ Installing FrankenPHP %s to %s\n", version, store.Dir())
+	if _, err := store.Install(version); err != nil {
+		return err
+	}
+	if _, err := store.Current(); errors.Is(err, frankenphp.ErrNoVersion) {
+		return useFrankenPHP(store, version)
+	}
+	fmt.Printf("Switch to it with: miner frankenphp use %s\n", version)
+	return nil
+}
+
+// installFrankenPHPFrom installs and puts in use the release found at src,
+// without network access; see frankenphp.Store.InstallFrom
+func installFrankenPHPFrom(store *frankenphp.Store, src, sum string) error {
+	fmt.Printf("✓ Installing FrankenPHP from %s to %s\n", src, store.Dir())
+	version, err := store.InstallFrom(src, sum, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Using FrankenPHP %s\n", version)
+	if _, err := config.DialInstance(); err == nil {
+		fmt.Println("Restart the running instance to pick it up: miner restart")
+	}
+	return nil
+}
+
+// useFrankenPHP switches the store to an installed version that meets
+// frankenphp.MinVersion
+func useFrankenPHP(store *frankenphp.Store, version string) error {
+	// A binary that does not report its version is allowed
+	if v, err := frankenphp.CheckVersion(runner.Exec{}, store.Binary(version)); v != "" && err != nil {
+		return err
+	}
+	if err := store.Use(version); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Using FrankenPHP %s\n", version)
+	if _, err := config.DialInstance(); err == nil {
+		fmt.Println("Restart the running instance to pick it up: miner restart")
+	}
+	return nil
+}
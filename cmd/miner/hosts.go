@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/elevation"
+	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// runHosts lists and edits Miner's block of the hosts file. A per-user install
+// runs it elevated so that only this step needs administrator/root privileges.
+func runHosts(args []string, logger *slog.Logger) error {
+	usage := fmt.Errorf("usage: miner hosts list | add <domain>... [ip]... | remove <domain>... | restore [n|backup]")
+	if len(args) < 1 {
+		return usage
+	}
+
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+	m := hosts.NewManager(cfg.HostsPath, logger)
+
+	action := args[0]
+	switch {
+	case action == "list" && len(args) == 1:
+		return listHosts(cfg, m)
+	case action == "restore" && len(args) == 1:
+		return listHostsBackups(m)
+	case action == "restore" && len(args) == 2:
+	case action == "add" && len(args) >= 2:
+	case action == "remove" && len(args) >= 2:
+	default:
+		return usage
+	}
+
+	if !elevation.IsElevated() {
+		fmt.Println("Editing the hosts file requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
+	}
+
+	switch action {
+	case "add":
+		// Addresses follow the domains; without any, the configured ones are used
+		var domains, ips []string
+		for _, arg := range args[1:] {
+			if net.ParseIP(arg) != nil {
+				ips = append(ips, arg)
+			} else {
+				domains = append(domains, arg)
+			}
+		}
+		if len(domains) == 0 {
+			return usage
+		}
+		if len(ips) == 0 {
+			ips = cfg.HostIPs()
+		}
+		for _, domain := range domains {
+			fmt.Printf("✓ Adding hosts entry: %s -> %s\n", domain, strings.Join(ips, ", "))
+			if err := m.AddEntry(domain, ips...); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "remove":
+		for _, domain := range args[1:] {
+			fmt.Printf("✓ Removing hosts entry: %s\n", domain)
+			if err := m.RemoveEntry(domain); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		backup, err := hostsBackup(m, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Restoring %s from %s\n", cfg.HostsPath, backup)
+		return m.Restore(backup)
+	}
+}
+
+// listHosts prints how each configured domain resolves, followed by any other
+// entries in Miner's block
+func listHosts(cfg *config.Config, m *hosts.Manager) error {
+	configured := map[string]bool{}
+	fmt.Printf("Configured domains (%s):\n", cfg.HostsPath)
+	for _, domain := range cfg.Domains() {
+		configured[strings.ToLower(domain)] = true
+		if !hostsEntryNeeded(cfg, domain) {
+			fmt.Printf("  ✓ %s (resolves without a hosts entry)\n", domain)
+			continue
+		}
+		mappings, err := m.Mappings(domain)
+		if err != nil {
+			return err
+		}
+		for _, ip := range cfg.HostIPs() {
+			fmt.Printf("  %s\n", describeMapping(domain, ip, mappings))
+		}
+	}
+
+	entries, err := m.Entries()
+	if err != nil {
+		return err
+	}
+	var others []hosts.Mapping
+	for _, e := range entries {
+		if !configured[strings.ToLower(e.Domain)] {
+			others = append(others, e)
+		}
+	}
+	if len(others) > 0 {
+		fmt.Println()
+		fmt.Println("Other entries managed by Miner:")
+		for _, e := range others {
+			fmt.Printf("  %s -> %s\n", e.Domain, e.IP)
+		}
+	}
+	return nil
+}
+
+// describeMapping reports how domain resolves for the address family of ip
+func describeMapping(domain, ip string, mappings []hosts.Mapping) string {
+	got, ok := hosts.Resolve(mappings, ip)
+	switch {
+	case !ok:
+		return fmt.Sprintf("✗ %s -> %s missing", domain, ip)
+	case net.ParseIP(got.IP).Equal(net.ParseIP(ip)) && got.Managed:
+		return fmt.Sprintf("✓ %s -> %s", domain, got.IP)
+	case net.ParseIP(got.IP).Equal(net.ParseIP(ip)):
+		return fmt.Sprintf("✓ %s -> %s (not managed by Miner)", domain, got.IP)
+	case got.Managed:
+		return fmt.Sprintf("✗ %s -> %s (expected %s)", domain, got.IP, ip)
+	default:
+		return fmt.Sprintf("✗ %s -> %s (expected %s; not managed by Miner)", domain, got.IP, ip)
+	}
+}
+
+// hostsEntryNeeded reports whether domain must be mapped in the hosts file
+func hostsEntryNeeded(cfg *config.Config, domain string) bool {
+	for _, d := range cfg.HostsDomains() {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// hostsInstalled reports whether every configured domain resolves to each
+// of the configured addresses; a stale or partial entry counts as missing
+func hostsInstalled(cfg *config.Config, m *hosts.Manager) bool {
+	ips := cfg.HostIPs()
+	for _, domain := range cfg.HostsDomains() {
+		if has, _ := m.HasEntry(domain, ips...); !has {
+			return false
+		}
+	}
+	return true
+}
+
+// hostsToAdd returns the configured domains whose entries Miner has to write:
+// those that do not resolve to every address yet, and those it already
+// manages. Correct entries the user wrote are left alone. An entry the user
+// wrote with another address comes first and shadows Miner's; it is reported
+// in shadowed.
+func hostsToAdd(cfg *config.Config, m *hosts.Manager) (domains, shadowed []string) {
+	ips := cfg.HostIPs()
+	for _, domain := range cfg.HostsDomains() {
+		if has, _ := m.HasEntry(domain, ips...); has && !managedEntry(m, domain) {
+			continue
+		}
+		mappings, _ := m.Mappings(domain)
+		domains = append(domains, domain)
+		for _, ip := range ips {
+			if got, ok := hosts.Resolve(mappings, ip); ok && !got.Managed && !net.ParseIP(got.IP).Equal(net.ParseIP(ip)) {
+				shadowed = append(shadowed, fmt.Sprintf("%s -> %s", domain, got.IP))
+			}
+		}
+	}
+	return domains, shadowed
+}
+
+// managedEntry reports whether Miner's block maps domain
+func managedEntry(m *hosts.Manager, domain string) bool {
+	mappings, _ := m.Mappings(domain)
+	for _, mp := range mappings {
+		if mp.Managed {
+			return true
+		}
+	}
+	return false
+}
+
+// addHostsEntries maps domains to the configured addresses, elevating just
+// this step for a per-user install, and records them in the manifest
+func addHostsEntries(cfg *config.Config, m *hosts.Manager, domains []string, user bool, record manifest.Recorder) error {
+	ips := cfg.HostIPs()
+	if user {
+		args := append([]string{"hosts", "add"}, domains...)
+		if err := elevation.RunElevated(runner.Exec{}, append(args, ips...)...); err != nil {
+			return err
+		}
+	} else {
+		for _, domain := range domains {
+			if err := m.AddEntry(domain, ips...); err != nil {
+				return err
+			}
+		}
+	}
+	for _, domain := range domains {
+		for _, ip := range ips {
+			record.Record(manifest.Change{Component: manifest.ComponentHosts, Kind: manifest.KindHostsEntry, Path: cfg.HostsPath, Value: domain, IP: ip})
+		}
+	}
+	return nil
+}
+
+// listHostsBackups prints the hosts file backups for `miner hosts restore`
+func listHostsBackups(m *hosts.Manager) error {
+	backups, err := m.Backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No hosts file backups found.")
+		return nil
+	}
+	fmt.Println("Hosts file backups (newest first):")
+	for i, b := range backups {
+		fmt.Printf("  %d  %s  %s\n", i+1, b.Time.Format("2006-01-02 15:04:05"), b.Path)
+	}
+	fmt.Println()
+	fmt.Println("Restore one with: sudo miner hosts restore <n>")
+	return nil
+}
+
+// hostsBackup resolves a backup given by its number in the list or its path
+func hostsBackup(m *hosts.Manager, arg string) (string, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return arg, nil
+	}
+	backups, err := m.Backups()
+	if err != nil {
+		return "", err
+	}
+	if n < 1 || n > len(backups) {
+		return "", fmt.Errorf("no backup %d; run 'miner hosts restore' to list them", n)
+	}
+	return backups[n-1].Path, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/logfile"
+)
+
+// followInterval is how often `miner logs -f` polls for new output
+const followInterval = 500 * time.Millisecond
+
+// runLogs prints the FrankenPHP log of the running (or last) instance.
+func runLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "Follow the log as it grows")
+	fs.BoolVar(follow, "follow", false, "Follow the log as it grows")
+	since := fs.String("since", "", "Only show lines newer than a duration (e.g. 30m) or an RFC3339 time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: miner logs [-f] [--since 1h]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	var cutoff time.Time
+	if *since != "" {
+		var err error
+		if cutoff, err = parseSince(*since); err != nil {
+			return err
+		}
+	}
+
+	path := currentLogFile()
+	if path == "" {
+		return fmt.Errorf("no FrankenPHP logs found (looked for %s)", strings.Join(config.LogFiles(), ", "))
+	}
+
+	for _, file := range append(logfile.Rotated(path), path) {
+		if info, err := os.Stat(file); err != nil || info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := printLog(file, cutoff); err != nil {
+			return err
+		}
+	}
+
+	if *follow {
+		return followLog(path)
+	}
+	return nil
+}
+
+// currentLogFile returns the most recently written log file, or ""
+func currentLogFile() string {
+	newest, newestTime := "", time.Time{}
+	for _, path := range config.LogFiles() {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+	}
+	return newest
+}
+
+// parseSince accepts a duration relative to now or an absolute RFC3339 time
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (want a duration like 30m or an RFC3339 time)", value)
+}
+
+// printLog prints the lines of file written at or after cutoff
+func printLog(file string, cutoff time.Time) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	show := cutoff.IsZero()
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Lines without a timestamp belong to the previous line
+		if ts, _, ok := logfile.ParseLine(line); ok && !cutoff.IsZero() {
+			show = !ts.Before(cutoff)
+		}
+		if show {
+			fmt.Println(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// followLog prints data appended to path until interrupted, reopening the
+// file when it is rotated.
+func followLog(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return err
+		}
+		time.Sleep(followInterval)
+
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		latest, err := os.Stat(path)
+		if err != nil {
+			continue // being rotated
+		}
+		if !os.SameFile(current, latest) {
+			// Drain what was written before rotation, then switch files
+			io.Copy(os.Stdout, f)
+			f.Close()
+			if f, err = os.Open(path); err != nil {
+				return err
+			}
+		}
+	}
+}
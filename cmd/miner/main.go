@@ -1,40 +1,138 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/4nkitd/miner/internal/assets"
-	"github.com/4nkitd/miner/internal/cli"
+	"github.com/4nkitd/miner/internal/browser"
 	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/control"
 	"github.com/4nkitd/miner/internal/elevation"
 	"github.com/4nkitd/miner/internal/frankenphp"
 	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/instance"
+	"github.com/4nkitd/miner/internal/logging"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
 	"github.com/4nkitd/miner/internal/server"
 	"github.com/4nkitd/miner/internal/systray"
+	"github.com/4nkitd/miner/internal/tlsca"
 )
 
 func main() {
+	args, logOpts, err := splitLogFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	// Diagnostics go to stderr through the logger; progress lines stay on stdout
+	logger, err := logging.New(os.Stderr, logOpts.level, logOpts.format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
 	// Check for subcommands
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	if len(args) > 0 {
+		switch args[0] {
 		case "install":
-			if err := runInstall(); err != nil {
+			if err := runInstall(args[1:], logger); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 			return
 		case "daemon":
-			if err := runDaemon(); err != nil {
+			if err := runDaemon(logger); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 			return
 		case "uninstall":
-			if err := runUninstall(); err != nil {
+			if err := runUninstall(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "open":
+			if err := runOpen(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "caddyfile":
+			if err := runCaddyfile(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "trust":
+			if err := runTrust(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "untrust":
+			if err := runUntrust(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "status":
+			if err := runStatus(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "doctor":
+			if err := runDoctor(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "start", "stop", "restart", "reload":
+			if err := runControl(args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "hosts":
+			if err := runHosts(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "frankenphp":
+			if err := runFrankenPHP(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "bundle":
+			if err := runBundle(args[1:], logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "logs":
+			if err := runLogs(args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "service":
+			// Entry point used by the installed auto-start service
+			if err := runService(logger); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
@@ -49,7 +147,7 @@ func main() {
 	}
 
 	// Default: run the app
-	if err := run(); err != nil {
+	if err := run(logger); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -61,49 +159,129 @@ func printHelp() {
 	fmt.Println("Usage:")
 	fmt.Println("  miner              Start the Miner system tray application")
 	fmt.Println("  miner daemon       Run headless server (no tray) in foreground")
+	fmt.Println("  miner open         Open Adminer of the running instance in the browser")
+	fmt.Println("  miner start|stop|restart  Control the server of the running instance")
+	fmt.Println("  miner reload       Re-read the configuration and restart the running instance")
+	fmt.Println("  miner status       Show what is installed and running (--json for scripts)")
+	fmt.Println("  miner doctor       Check the installation (--fix repairs broken pieces)")
+	fmt.Println("  miner logs         Show FrankenPHP logs (-f to follow, --since 1h)")
 	fmt.Println("  miner install      Install and configure Miner (requires admin/root)")
 	fmt.Println("  miner uninstall    Remove Miner configuration")
+	fmt.Println("  miner frankenphp list                 List the FrankenPHP versions Miner manages")
+	fmt.Println("  miner frankenphp install <version>    Download and verify a FrankenPHP release")
+	fmt.Println("  miner frankenphp install --from <path>  Install from a binary, mirror or bundle (offline)")
+	fmt.Println("  miner frankenphp use <version>        Switch to an installed FrankenPHP version")
+	fmt.Println("  miner frankenphp rollback             Switch back to the previous version")
+	fmt.Println("  miner bundle create [-o <file>]       Pack Miner, FrankenPHP and assets for offline installs")
+	fmt.Println("  miner hosts list                      Show how the configured domains resolve")
+	fmt.Println("  miner hosts add|remove <domain>...    Edit Miner's hosts file entries (requires admin/root)")
+	fmt.Println("  miner hosts restore [n|backup]        List hosts file backups, or restore one")
+	fmt.Println("  miner caddyfile print  Print the Caddyfile FrankenPHP is started with")
+	fmt.Println("  miner trust        Create the local HTTPS CA and add it to the system trust store")
+	fmt.Println("  miner untrust      Remove the local HTTPS CA from the system trust store")
 	fmt.Println("  miner help         Show this help message")
 	fmt.Println("  miner version      Show version information")
 	fmt.Println()
+	fmt.Println("Install/uninstall flags (see 'miner install -h'):")
+	fmt.Println("  --yes, -y          Non-interactive; answer yes to all prompts")
+	fmt.Println("  --no-service       Skip the auto-start service")
+	fmt.Println("  --no-cli           Skip the php, fphp and miner CLI wrappers")
+	fmt.Println("  --no-hosts         Skip the hosts file entry")
+	fmt.Println("  --no-frankenphp    Skip the FrankenPHP check and download; keep it on uninstall")
+	fmt.Println("  --dry-run          Show what would be removed (uninstall only)")
+	fmt.Println("  --user             Install for the current user only; no admin/root needed")
+	fmt.Println("                     except for the hosts entry (skip it with --no-hosts)")
+	fmt.Println("  --domain <name>    Domain to map in the hosts file")
+	fmt.Println("  --port <port>      Port to serve Adminer on (install only)")
+	fmt.Println("  --frankenphp-from <path>  Install FrankenPHP offline from a binary, mirror or bundle")
+	fmt.Println("  --frankenphp-sha256 <hex> Trust that SHA-256 for an unpinned --frankenphp-from binary")
+	fmt.Println()
+	fmt.Println("Global flags:")
+	fmt.Println("  --log-level <lvl>  debug, info (default), warn or error (MINER_LOG_LEVEL)")
+	fmt.Println("  --log-format <f>   text (default) or json (MINER_LOG_FORMAT)")
+	fmt.Println()
+	fmt.Println("Configuration (later entries take precedence):")
+	for _, path := range config.ConfigFiles() {
+		fmt.Printf("  %s\n", path)
+	}
+	fmt.Println()
+	fmt.Println("Environment variables (take precedence over config files):")
+	for _, ev := range config.EnvVars {
+		fmt.Printf("  %-24s %s\n", ev.Name, ev.Help)
+	}
+	fmt.Println()
 	fmt.Println("After installation, access Adminer at: http://miner.local")
 }
 
-func run() error {
+// chooseFrankenPHP asks whether to install Miner's FrankenPHP beside the one
+// found in PATH and use it instead; the default follows their versions
+func chooseFrankenPHP(e frankenphp.Existing) bool {
+	found := "FrankenPHP"
+	if e.Version != "" {
+		found += " " + e.Version
+	}
+	fmt.Printf("%s is already installed at %s; Miner ships FrankenPHP %s.\n", found, e.Path, frankenphp.DefaultVersion)
+	fmt.Println("It is left untouched either way, and uninstall removes only Miner's copy.")
+	older := e.Version != "" && frankenphp.CompareVersions(e.Version, frankenphp.DefaultVersion) < 0
+	return confirm(fmt.Sprintf("Install FrankenPHP %s for Miner and use it instead?", frankenphp.DefaultVersion), older)
+}
+
+func run(logger *slog.Logger) error {
 	// Load configuration
-	cfg, err := config.New()
+	cfg, err := loadConfig(logger)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
 	// Check if miner is installed (hosts entry exists)
-	hostsManager := hosts.NewManager(cfg.HostsPath)
-	hasHostEntry, _ := hostsManager.HasEntry(cfg.Domain)
-
-	if !hasHostEntry {
+	hostsManager := hosts.NewManager(cfg.HostsPath, logger)
+	if !hostsInstalled(cfg, hostsManager) && cfg.NeedsHostsEntry() {
 		fmt.Println("Miner is not installed yet. Please run:")
 		fmt.Println("  sudo miner install")
 		return fmt.Errorf("installation required")
 	}
 
+	// Only one instance may serve the port; attach to a running one instead
+	lock, err := config.AcquireLock(control.ModeTray)
+	var locked *instance.LockedError
+	if errors.As(err, &locked) {
+		defer assets.Cleanup(cfg.TempAssets)
+		return runAttached(cfg, locked, logger)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Initialize server (no privileges needed)
-	srv := server.NewServer(cfg.Port, cfg.Domain, cfg.AssetsDir)
+	srv := config.NewServer(cfg, logger)
+	detach := config.Attach(srv, cfg, logger)
+	defer detach()
+	ctl, err := config.ServeControl(srv, control.ModeTray, logger)
+	if err != nil {
+		logger.Warn("control socket unavailable", "err", err)
+	} else {
+		defer ctl.Close()
+	}
 
 	// Start server
-	fmt.Printf("Starting server on %s\n", cfg.URL())
+	fmt.Println("Starting server...")
 	if err := srv.Start(); err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
+	// The server may have fallen back to another port
+	cfg.Port = srv.Port()
 
 	// Initialize managers for systray
-	cliManager := cli.NewManager(cfg.BinaryPath)
-	svc, err := config.NewService(cfg)
+	user := userInstalled(cfg, logger)
+	_, svc, err := newManagers(cfg, user, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
+	u := &uninstaller{cfg: cfg, opts: &installOptions{yes: true, user: user}, logger: logger}
 
 	// Create and run system tray app
-	app := systray.NewApp(srv, hostsManager, cliManager, svc, cfg)
+	app := systray.NewApp(srv, u, svc, cfg, logger.With("component", "tray"))
 
 	fmt.Println("Miner is running. Check system tray for menu.")
 	fmt.Printf("Access Adminer at: %s\n", cfg.URL())
@@ -118,76 +296,210 @@ func run() error {
 	return nil
 }
 
-func runInstall() error {
+func runInstall(args []string, logger *slog.Logger) error {
+	opts, err := parseInstallFlags("install", args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
 	fmt.Println("Installing Miner...")
 	fmt.Println()
 
-	// Check for elevation early (needed for placing binary in /usr/local/bin)
-	if !elevation.IsElevated() {
-		fmt.Println("Installation requires administrator/root privileges.")
-		return elevation.RequestElevation()
-	}
-
-	// Ensure FrankenPHP is installed (auto-download on macOS/Linux)
-	if err := frankenphp.EnsureInstalled(); err != nil {
-		// If auto-install failed, fall back to manual guidance
-		fmt.Printf("Warning: %v\n", err)
-		if _, lookupErr := exec.LookPath("frankenphp"); lookupErr != nil {
-			fmt.Println("FrankenPHP is required for PHP execution.")
-			fmt.Println("Install manually with:")
-			fmt.Println("  curl https://frankenphp.dev/install.sh | sh")
-			fmt.Println("  sudo mv frankenphp /usr/local/bin/")
-			fmt.Print("Continue Miner installation without FrankenPHP? [y/N]: ")
-			var response string
-			fmt.Scanln(&response)
-			if response != "y" && response != "Y" {
-				return fmt.Errorf("installation cancelled")
-			}
-			fmt.Println()
+	// Check for elevation early (needed for placing binary in /usr/local/bin);
+	// a per-user install only elevates for the hosts entry
+	if opts.user && elevation.IsElevated() {
+		// Under sudo or pkexec, do it for the user who ran it
+		if ran, err := runAsInvokingUser(); ran || err != nil {
+			return err
 		}
+		return fmt.Errorf("--user installs for the invoking user; run it without sudo")
+	}
+	if !opts.user && !elevation.IsElevated() {
+		fmt.Println("Installation requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
 	}
 
 	// Load configuration
-	cfg, err := config.New()
+	cfg, err := loadConfig(logger)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
+	}
+	configFile := config.SystemConfigFile()
+	if opts.user {
+		if configFile, err = config.UserConfigFile(); err != nil {
+			return fmt.Errorf("failed to locate user config: %w", err)
+		}
+	}
+
+	// Apply command-line overrides; they are persisted to the config file below
+	var overridden []string
+	if opts.port != "" {
+		if err := cfg.SetPort(opts.port); err != nil {
+			return fmt.Errorf("invalid --port: %w", err)
+		}
+		overridden = append(overridden, "port")
+	}
+	if opts.domain != "" {
+		if err := hosts.ValidateHostname(opts.domain); err != nil {
+			return fmt.Errorf("invalid --domain: %w", err)
+		}
+		cfg.Domain = opts.domain
+		overridden = append(overridden, "domain")
+	}
+	if opts.user {
+		// Without a hosts entry the domain must resolve on its own
+		if opts.noHosts && opts.domain == "" && cfg.NeedsHostsEntry() {
+			cfg.Domain = "localhost"
+			overridden = append(overridden, "domain")
+		}
+		// Unprivileged processes cannot bind ports below 1024 on Linux
+		if port, _ := strconv.Atoi(cfg.Port); runtime.GOOS == "linux" && opts.port == "" && port < 1024 {
+			cfg.Port = userPort
+			overridden = append(overridden, "port")
+		}
+	}
+	addHosts := !opts.noHosts && cfg.NeedsHostsEntry()
+
+	interactive := isInteractive() && !opts.yes
+	if interactive {
+		fmt.Println("The following changes will be made:")
+		if opts.frankenphpFrom != "" {
+			fmt.Printf("  - Install FrankenPHP from %s to %s\n", opts.frankenphpFrom, frankenphpStore(cfg, opts.user, logger).Dir())
+		} else if !opts.noFrankenPHP {
+			fmt.Printf("  - Install FrankenPHP %s to %s if missing\n", frankenphp.DefaultVersion, frankenphpStore(cfg, opts.user, logger).Dir())
+		}
+		if len(overridden) > 0 {
+			fmt.Printf("  - Save %s to %s\n", strings.Join(overridden, ", "), configFile)
+		}
+		if addHosts && opts.user {
+			fmt.Printf("  - Add hosts entries: %s -> %s (asks for administrator/root privileges)\n", strings.Join(cfg.HostsDomains(), ", "), strings.Join(cfg.HostIPs(), ", "))
+		} else if addHosts {
+			fmt.Printf("  - Add hosts entries: %s -> %s\n", strings.Join(cfg.HostsDomains(), ", "), strings.Join(cfg.HostIPs(), ", "))
+		}
+		cliManager, _, _ := newManagers(cfg, opts.user, logger)
+		if !opts.noCLI {
+			fmt.Printf("  - Register CLI commands: php, fphp, miner in %s\n", cliManager.BinDir())
+		}
+		if !opts.noService && opts.user {
+			fmt.Println("  - Install and start the auto-start service for the current user")
+		} else if !opts.noService {
+			fmt.Println("  - Install and start the auto-start service")
+		}
+		if !confirm("Proceed?", true) {
+			return fmt.Errorf("installation cancelled")
+		}
+		fmt.Println()
+	}
+
+	// Record every change so that uninstall can revert exactly these steps
+	record, err := manifest.Open(config.ManifestFile(), config.AppVersion, scopeName(opts.user))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := record.Save(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}()
+
+	// Ensure FrankenPHP is installed (verified download on macOS/Linux)
+	if opts.frankenphpFrom != "" {
+		// Asked for explicitly, so a failure is not worked around
+		version, err := frankenphpStore(cfg, opts.user, logger).InstallFrom(opts.frankenphpFrom, opts.frankenphpSHA256, record)
+		if err != nil {
+			return fmt.Errorf("failed to install FrankenPHP from %s: %w", opts.frankenphpFrom, err)
+		}
+		fmt.Printf("✓ Installed FrankenPHP %s from %s\n", version, opts.frankenphpFrom)
+	} else if !opts.noFrankenPHP {
+		store := frankenphpStore(cfg, opts.user, logger)
+		if interactive {
+			store.SetChooser(chooseFrankenPHP)
+		}
+		if err := store.EnsureInstalled(record); err != nil {
+			// If auto-install failed, fall back to manual guidance
+			fmt.Printf("Warning: %v\n", err)
+			if _, lookupErr := config.FrankenPHPPath(); lookupErr != nil {
+				if err := frankenphpMissing(opts, interactive); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	// Initialize managers
-	hostsManager := hosts.NewManager(cfg.HostsPath)
-	cliManager := cli.NewManager(cfg.BinaryPath)
-	svc, err := config.NewService(cfg)
+	hostsManager := hosts.NewManager(cfg.HostsPath, logger)
+	cliManager, svc, err := newManagers(cfg, opts.user, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
+	cliManager.SetRecorder(record)
+
+	// Persist overrides so the tray, daemon and service resolve the same config
+	if len(overridden) > 0 {
+		fmt.Printf("✓ Saving configuration to %s\n", configFile)
+		if err := cfg.SaveTo(configFile, overridden...); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		for _, key := range overridden {
+			record.Record(manifest.Change{Component: manifest.ComponentConfig, Kind: manifest.KindConfigKey, Path: configFile, Value: key})
+		}
+	}
 
-	// Setup hosts entry
-	fmt.Printf("✓ Adding hosts entry: %s -> %s\n", cfg.Domain, cfg.Host)
-	if err := hostsManager.AddEntry(cfg.Domain, cfg.Host); err != nil {
-		return fmt.Errorf("failed to add hosts entry: %w", err)
+	// Setup hosts entries; entries the user already had are left alone on uninstall
+	if addHosts {
+		domains, shadowed := hostsToAdd(cfg, hostsManager)
+		for _, entry := range shadowed {
+			fmt.Printf("  Warning: %s maps %s outside Miner's block; edit that line to use %s\n", cfg.HostsPath, entry, strings.Join(cfg.HostIPs(), ", "))
+		}
+		if len(domains) > 0 {
+			suffix := ""
+			if opts.user {
+				// The only step of a per-user install that needs privileges
+				suffix = " (elevated)"
+			}
+			fmt.Printf("✓ Adding hosts entries: %s -> %s%s\n", strings.Join(domains, ", "), strings.Join(cfg.HostIPs(), ", "), suffix)
+			if err := addHostsEntries(cfg, hostsManager, domains, opts.user, record); err != nil {
+				if opts.user {
+					return fmt.Errorf("failed to add hosts entries: %w; rerun with --no-hosts to use localhost instead", err)
+				}
+				return fmt.Errorf("failed to add hosts entries: %w", err)
+			}
+		}
 	}
 
 	// Register CLI commands
-	fmt.Println("✓ Registering CLI commands: php, fphp, miner")
-	if err := cliManager.Register(); err != nil {
-		return fmt.Errorf("failed to register CLI commands: %w", err)
+	if !opts.noCLI {
+		fmt.Println("✓ Registering CLI commands: php, fphp, miner")
+		if err := cliManager.Register(); err != nil {
+			return fmt.Errorf("failed to register CLI commands: %w", err)
+		}
 	}
 
 	// Install auto-start service
-	fmt.Println("✓ Installing auto-start service")
-	if err := svc.Install(); err != nil {
-		fmt.Printf("  Warning: Failed to install auto-start: %v\n", err)
-	} else {
-		if err := svc.Start(); err != nil {
-			fmt.Printf("  Warning: Failed to start service: %v\n", err)
+	if !opts.noService {
+		fmt.Println("✓ Installing auto-start service")
+		if err := svc.Install(); err != nil {
+			fmt.Printf("  Warning: Failed to install auto-start: %v\n", err)
 		} else {
-			fmt.Println("  Service started in background (persistent daemon).")
+			record.Record(manifest.Change{Component: manifest.ComponentService, Kind: manifest.KindService, Value: scopeName(opts.user)})
+			if err := svc.Start(); err != nil {
+				fmt.Printf("  Warning: Failed to start service: %v\n", err)
+			} else {
+				fmt.Println("  Service started in background (persistent daemon).")
+			}
 		}
 	}
 
 	fmt.Println()
 	fmt.Println("✓ Installation complete!")
 	fmt.Println()
+	if opts.user && !cliManager.OnPath() {
+		fmt.Printf("Open a new terminal so that %s is on your PATH.\n", cliManager.BinDir())
+		fmt.Println()
+	}
 	fmt.Println("To start Miner, run:")
 	fmt.Println("  miner")
 	fmt.Println()
@@ -196,81 +508,229 @@ func runInstall() error {
 	return nil
 }
 
-func runUninstall() error {
-	fmt.Println("Uninstalling Miner...")
+// userPort is the default port of a per-user install on Linux, where the
+// default port 88 needs root
+const userPort = "8088"
+
+// frankenphpMissing prints how to install FrankenPHP by hand and decides
+// whether the installation continues without it
+func frankenphpMissing(opts *installOptions, interactive bool) error {
+	fmt.Println("FrankenPHP is required for PHP execution.")
+	fmt.Println("Install it later with:")
+	if opts.user {
+		fmt.Printf("  miner frankenphp install %s\n", frankenphp.DefaultVersion)
+	} else {
+		fmt.Printf("  sudo miner frankenphp install %s\n", frankenphp.DefaultVersion)
+	}
+	fmt.Println("or, without internet access, from a release binary or `miner bundle create` tarball:")
+	if opts.user {
+		fmt.Println("  miner install --user --frankenphp-from <path>")
+	} else {
+		fmt.Println("  sudo miner install --frankenphp-from <path>")
+	}
+	fmt.Println("or put a frankenphp binary in your PATH.")
+	switch {
+	case opts.yes:
+		fmt.Println("Continuing without FrankenPHP (--yes).")
+	case interactive:
+		if !confirm("Continue Miner installation without FrankenPHP?", false) {
+			return fmt.Errorf("installation cancelled")
+		}
+	default:
+		return fmt.Errorf("FrankenPHP is not installed; rerun with --yes or --no-frankenphp to continue without it")
+	}
 	fmt.Println()
+	return nil
+}
 
-	// Check for elevation
-	if !elevation.IsElevated() {
-		fmt.Println("Uninstallation requires administrator/root privileges.")
-		return elevation.RequestElevation()
+// loadConfig resolves the configuration and logs where it came from
+func loadConfig(logger *slog.Logger) (*config.Config, error) {
+	cfg, err := config.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	logger.Debug("configuration loaded", "sources", cfg.Sources, "port", cfg.Port, "domain", cfg.Domain, "assets", cfg.AssetsDir)
+	return cfg, nil
+}
 
-	// Load configuration
-	cfg, err := config.New()
+// runDaemon starts the server headlessly (no tray UI) and blocks until interrupted.
+func runDaemon(logger *slog.Logger) error {
+	cfg, err := loadConfig(logger)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	// Initialize managers
-	hostsManager := hosts.NewManager(cfg.HostsPath)
-	cliManager := cli.NewManager(cfg.BinaryPath)
-	svc, err := config.NewService(cfg)
+	hostsManager := hosts.NewManager(cfg.HostsPath, logger)
+	if !hostsInstalled(cfg, hostsManager) && cfg.NeedsHostsEntry() {
+		return fmt.Errorf("hosts entry missing; run 'sudo miner install' first")
+	}
+
+	defer func() {
+		if cfg.TempAssets != "" {
+			assets.Cleanup(cfg.TempAssets)
+		}
+	}()
+
+	lock, err := config.AcquireLock(control.ModeDaemon)
 	if err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
+		return fmt.Errorf("%w; stop it with 'miner stop' first", err)
+	}
+	defer lock.Release()
+
+	srv := config.NewServer(cfg, logger)
+	detach := config.Attach(srv, cfg, logger)
+	defer detach()
+	// Output goes to the log file; also show it in the foreground
+	srv.SetConsole(true)
+	transitions, unsubscribe := srv.Subscribe()
+	defer unsubscribe()
+
+	ctl, err := config.ServeControl(srv, control.ModeDaemon, logger)
+	if err != nil {
+		logger.Warn("control socket unavailable", "err", err)
+	} else {
+		defer ctl.Close()
+	}
+
+	fmt.Println("Starting headless server...")
+	if err := srv.Start(); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	fmt.Printf("Headless server running on %s. Press Ctrl+C to stop.\n", srv.URL())
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	done := srv.Done()
+	for {
+		select {
+		case <-sigCh:
+			fmt.Println("Stopping server...")
+			_ = srv.Stop()
+			fmt.Println("Server stopped")
+			return nil
+		case t := <-transitions:
+			logger.Info("server state changed", "from", t.From, "to", t.To)
+			if t.To == server.StateRunning {
+				// (Re)started, possibly through the control socket
+				done = srv.Done()
+			}
+		case <-done:
+			if srv.State() != server.StateCrashed {
+				// Stopped or restarted through the control socket; keep serving it
+				done = nil
+				continue
+			}
+			// The supervisor has given up (or the restart policy forbids a restart)
+			st := srv.Status()
+			if st.LastExit == nil {
+				return fmt.Errorf("server stopped unexpectedly")
+			}
+			for _, line := range st.LastExit.StderrTail {
+				fmt.Fprintf(os.Stderr, "  %s\n", line)
+			}
+			return fmt.Errorf("server stopped: %s", st.LastExit)
+		}
+	}
+}
+
+// runService runs the server under the system service manager (invoked by the installed service).
+func runService(logger *slog.Logger) error {
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
 	}
+	// The service program loads its own config on start
+	defer assets.Cleanup(cfg.TempAssets)
 
-	// Remove hosts entry
-	fmt.Printf("✓ Removing hosts entry: %s\n", cfg.Domain)
-	if err := hostsManager.RemoveEntry(cfg.Domain); err != nil {
-		fmt.Printf("  Warning: Failed to remove hosts entry: %v\n", err)
+	svc, err := config.NewService(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
 	}
+	return svc.Run()
+}
 
-	// Unregister CLI commands
-	fmt.Println("✓ Unregistering CLI commands")
-	if err := cliManager.Unregister(); err != nil {
-		fmt.Printf("  Warning: Failed to unregister CLI commands: %v\n", err)
+// runOpen opens Adminer in the browser, using the port of the running instance.
+func runOpen() error {
+	cfg, err := config.New()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	defer assets.Cleanup(cfg.TempAssets)
 
-	// Uninstall auto-start service
-	fmt.Println("✓ Uninstalling auto-start service")
-	if err := svc.Uninstall(); err != nil {
-		fmt.Printf("  Warning: Failed to uninstall service: %v\n", err)
+	return browser.Open(runner.Exec{}, cfg.ActiveURL())
+}
+
+// runCaddyfile handles `miner caddyfile print`.
+func runCaddyfile(args []string, logger *slog.Logger) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: miner caddyfile print")
 	}
 
-	fmt.Println()
-	fmt.Println("✓ Uninstallation complete!")
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	defer assets.Cleanup(cfg.TempAssets)
 
+	content, err := config.NewServer(cfg, logger).Caddyfile()
+	if err != nil {
+		return err
+	}
+	fmt.Print(content)
 	return nil
 }
 
-// runDaemon starts the server headlessly (no tray UI) and blocks until interrupted.
-func runDaemon() error {
+// runTrust creates the local CA (and a certificate for the domain) and adds
+// the CA to the system trust store.
+func runTrust() error {
+	if !elevation.IsElevated() {
+		fmt.Println("Trusting the local CA requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
+	}
+
 	cfg, err := config.New()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	defer assets.Cleanup(cfg.TempAssets)
 
-	hostsManager := hosts.NewManager(cfg.HostsPath)
-	if has, _ := hostsManager.HasEntry(cfg.Domain); !has {
-		return fmt.Errorf("hosts entry missing; run 'sudo miner install' first")
+	// Issue the certificate now so unprivileged instances can use it as-is
+	caPath, err := tlsca.EnsureCA(cfg.TLSDir)
+	if err != nil {
+		return fmt.Errorf("failed to create local CA: %w", err)
 	}
+	if _, _, err := tlsca.EnsureLeaf(cfg.TLSDir, cfg.Domains()); err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	fmt.Printf("✓ Local CA: %s\n", caPath)
 
-	srv := server.NewServer(cfg.Port, cfg.Domain, cfg.AssetsDir)
-	fmt.Printf("Starting headless server on %s\n", cfg.URL())
-	if err := srv.Start(); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	if err := tlsca.Trust(runner.Exec{}, caPath); err != nil {
+		return fmt.Errorf("failed to trust local CA: %w", err)
 	}
-	fmt.Println("Headless server running. Press Ctrl+C to stop.")
+	fmt.Println("✓ Local CA added to the system trust store")
+	if !cfg.TLS {
+		fmt.Println()
+		fmt.Printf("Enable HTTPS by setting \"tls\": true in %s (or MINER_TLS=1)\n", config.SystemConfigFile())
+	}
+	return nil
+}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-	fmt.Println("Stopping server...")
-	_ = srv.Stop()
-	if cfg.TempAssets != "" {
-		assets.Cleanup(cfg.TempAssets)
+// runUntrust removes the local CA from the system trust store.
+func runUntrust() error {
+	if !elevation.IsElevated() {
+		fmt.Println("Removing the local CA requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+
+	if err := tlsca.Untrust(runner.Exec{}, filepath.Join(cfg.TLSDir, tlsca.CAFile)); err != nil {
+		return fmt.Errorf("failed to remove local CA: %w", err)
 	}
-	fmt.Println("Server stopped")
+	fmt.Println("✓ Local CA removed from the system trust store")
 	return nil
 }
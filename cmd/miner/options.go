@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/config"
+)
+
+// logOptions holds the global --log-level and --log-format flags
+type logOptions struct {
+	level  string
+	format string
+}
+
+// splitLogFlags removes the global logging flags from args, wherever they
+// appear, and returns the remaining arguments. Both accept "--flag value" and
+// "--flag=value"; unset flags default to MINER_LOG_LEVEL and MINER_LOG_FORMAT.
+func splitLogFlags(args []string) ([]string, logOptions, error) {
+	opts := logOptions{
+		level:  os.Getenv(config.EnvLogLevel),
+		format: os.Getenv(config.EnvLogFormat),
+	}
+	targets := map[string]*string{"log-level": &opts.level, "log-format": &opts.format}
+
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		target, ok := targets[name]
+		if !ok || !strings.HasPrefix(args[i], "-") {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, opts, fmt.Errorf("flag needs an argument: --%s", name)
+			}
+			i++
+			value = args[i]
+		}
+		*target = value
+	}
+	return rest, opts, nil
+}
+
+// installOptions selects which components install/uninstall touch
+type installOptions struct {
+	yes          bool
+	noService    bool
+	noCLI        bool
+	noHosts      bool
+	noFrankenPHP bool
+	user         bool
+	dryRun       bool
+	domain       string
+	port         string
+
+	frankenphpFrom   string // install FrankenPHP offline from this binary, mirror or bundle
+	frankenphpSHA256 string
+}
+
+// parseInstallFlags parses the flags shared by the install and uninstall subcommands
+func parseInstallFlags(name string, args []string) (*installOptions, error) {
+	opts := &installOptions{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&opts.yes, "yes", false, "Answer yes to all prompts (non-interactive)")
+	fs.BoolVar(&opts.yes, "y", false, "Shorthand for --yes")
+	fs.BoolVar(&opts.noService, "no-service", false, "Skip the auto-start service")
+	fs.BoolVar(&opts.noCLI, "no-cli", false, "Skip the php, fphp and miner CLI wrappers")
+	fs.BoolVar(&opts.noHosts, "no-hosts", false, "Skip the hosts file entry")
+	fs.BoolVar(&opts.user, "user", false, "Install for the current user only (~/.local/bin, user service, user config)")
+	fs.StringVar(&opts.domain, "domain", "", "Domain to map in the hosts file (default from config)")
+	if name == "uninstall" {
+		fs.BoolVar(&opts.dryRun, "dry-run", false, "Show what would be removed without changing anything")
+		fs.BoolVar(&opts.noFrankenPHP, "no-frankenphp", false, "Keep the FrankenPHP versions Miner installed")
+	}
+	if name == "install" {
+		fs.BoolVar(&opts.noFrankenPHP, "no-frankenphp", false, "Skip the FrankenPHP check and download")
+		fs.StringVar(&opts.port, "port", "", "Port to serve Adminer on (default from config)")
+		fs.StringVar(&opts.frankenphpFrom, "frankenphp-from", "", "Install FrankenPHP offline from a release binary, mirror directory or bundle tarball")
+		fs.StringVar(&opts.frankenphpSHA256, "frankenphp-sha256", "", "SHA-256 of the --frankenphp-from binary, for releases Miner has no checksum for")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: miner %s [flags]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if opts.frankenphpSHA256 != "" && opts.frankenphpFrom == "" {
+		return nil, fmt.Errorf("--frankenphp-sha256 needs --frankenphp-from")
+	}
+	if opts.frankenphpFrom != "" && opts.noFrankenPHP {
+		return nil, fmt.Errorf("--frankenphp-from and --no-frankenphp are mutually exclusive")
+	}
+	return opts, nil
+}
+
+// isInteractive reports whether stdin is a terminal we can prompt on
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on stdin, returning def on an empty answer
+func confirm(question string, def bool) bool {
+	hint := "[y/N]"
+	if def {
+		hint = "[Y/n]"
+	}
+	fmt.Printf("%s %s: ", question, hint)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		return def
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "":
+		return def
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
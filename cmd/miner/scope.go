@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/4nkitd/miner/internal/cli"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/elevation"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// newManagers returns the CLI and service managers of a system-wide or a
+// per-user (--user) install. Under sudo or pkexec, shell profiles are those
+// of the invoking user rather than root's.
+func newManagers(cfg *config.Config, user bool, logger *slog.Logger) (*cli.Manager, *config.MinerService, error) {
+	cliManager := cli.NewManager(cfg.BinaryPath, logger)
+	cliManager.SetUser(user)
+	cliManager.SetFrankenPHP(frankenphpStore(cfg, user, logger).CurrentBinary())
+	if owner, err := elevation.InvokingUser(); err != nil {
+		logger.Warn("cannot resolve the invoking user; editing root's shell profiles", "err", err)
+	} else {
+		cliManager.SetOwner(owner)
+	}
+	svc, err := config.NewService(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc.SetUser(user)
+	return cliManager, svc, nil
+}
+
+// frankenphpStore returns the FrankenPHP store of a system-wide or a
+// per-user install. Releases come from the frankenphp_mirror setting if set.
+func frankenphpStore(cfg *config.Config, user bool, logger *slog.Logger) *frankenphp.Store {
+	dir := config.SystemFrankenPHPDir()
+	if user {
+		dir = config.FrankenPHPDir()
+	}
+	store := frankenphp.NewStore(dir, logger)
+	store.SetInstaller(frankenphpInstaller(cfg, logger))
+	return store
+}
+
+// frankenphpInstaller returns an installer that downloads from the
+// frankenphp_mirror setting, or from GitHub when it is unset
+func frankenphpInstaller(cfg *config.Config, logger *slog.Logger) *frankenphp.Installer {
+	installer := frankenphp.NewInstaller(logger)
+	if cfg.FrankenPHPMirror != "" {
+		installer.BaseURL = cfg.FrankenPHPMirror
+	}
+	return installer
+}
+
+// userInstalled reports whether the current (non-root) user has run
+// `miner install --user`; its wrappers and service then take precedence
+// over a system-wide install
+func userInstalled(cfg *config.Config, logger *slog.Logger) bool {
+	if elevation.IsElevated() {
+		return false
+	}
+	cliManager, svc, err := newManagers(cfg, true, logger)
+	if err != nil {
+		return false
+	}
+	for _, ok := range cliManager.Installed() {
+		if ok {
+			return true
+		}
+	}
+	state, err := svc.Status()
+	return err == nil && state != "Not installed"
+}
+
+// installCommand returns the command that (re)installs the given scope
+func installCommand(user bool) string {
+	if user {
+		return "miner install --user"
+	}
+	return "sudo miner install"
+}
+
+// scopeName names the install scope in status output
+func scopeName(user bool) string {
+	if user {
+		return "user"
+	}
+	return "system"
+}
+
+// runAsInvokingUser reruns this command as the user who started it with sudo
+// or pkexec, for steps that belong to that user (--user). It reports false
+// when there is no such user.
+func runAsInvokingUser() (bool, error) {
+	owner, err := elevation.InvokingUser()
+	if err != nil || owner == nil {
+		return false, err
+	}
+	fmt.Printf("Continuing as %s...\n", owner.Name)
+	return true, elevation.RunAs(runner.Exec{}, owner, os.Args[1:]...)
+}
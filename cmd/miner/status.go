@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/cli"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/control"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/instance"
+	"github.com/4nkitd/miner/internal/runner"
+	"github.com/4nkitd/miner/internal/server"
+)
+
+// statusReport is the output of `miner status`. Its JSON form is consumed by
+// scripts: add fields freely, but do not rename or remove existing ones.
+type statusReport struct {
+	Version    string           `json:"version"`
+	OK         bool             `json:"ok"`
+	Scope      string           `json:"scope"` // system, or user after `miner install --user`
+	Hosts      hostsStatus      `json:"hosts"`
+	CLI        cliStatus        `json:"cli"`
+	Service    serviceStatus    `json:"service"`
+	FrankenPHP frankenphpStatus `json:"frankenphp"`
+	Assets     assetsStatus     `json:"assets"`
+	Adminer    adminerStatus    `json:"adminer"`
+	Server     serverStatus     `json:"server"`
+	Instance   instanceStatus   `json:"instance"`
+}
+
+type hostsStatus struct {
+	Path       string `json:"path"`
+	Domain     string `json:"domain"`
+	Required   bool   `json:"required"` // false for localhost and IP addresses
+	Present    bool   `json:"present"`
+	Managed    bool   `json:"managed"` // inside Miner's block rather than written by the user
+	IP         string `json:"ip"`
+	ExpectedIP string `json:"expected_ip"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+
+	// Entries covers every configured domain and address; the fields above
+	// describe the IPv4 entry of the main domain
+	Entries []hostsEntryStatus `json:"entries"`
+}
+
+// hostsEntryStatus is how one configured domain resolves for one address
+type hostsEntryStatus struct {
+	Domain     string `json:"domain"`
+	IP         string `json:"ip"`
+	ExpectedIP string `json:"expected_ip"`
+	Managed    bool   `json:"managed"`
+	OK         bool   `json:"ok"`
+}
+
+type cliStatus struct {
+	Dir        string          `json:"dir"`
+	Commands   map[string]bool `json:"commands"`
+	Registered bool            `json:"registered"`
+	OnPath     bool            `json:"on_path"`
+}
+
+type serviceStatus struct {
+	Installed bool   `json:"installed"`
+	Running   bool   `json:"running"`
+	State     string `json:"state"` // running, stopped, not-installed or unknown
+	Error     string `json:"error,omitempty"`
+}
+
+type frankenphpStatus struct {
+	Found   bool   `json:"found"`
+	Path    string `json:"path"`
+	Managed bool   `json:"managed"` // the version in use of Miner's store rather than one in PATH
+	Version string `json:"version"`
+	Error   string `json:"error,omitempty"`
+}
+
+type assetsStatus struct {
+	Dir    string `json:"dir"`
+	Source string `json:"source"` // filesystem or embedded
+}
+
+type adminerStatus struct {
+	Version string `json:"version"`
+	Error   string `json:"error,omitempty"`
+}
+
+type serverStatus struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// instanceStatus describes the Miner process found on a control socket
+type instanceStatus struct {
+	Running  bool   `json:"running"`
+	Mode     string `json:"mode,omitempty"` // tray, daemon or service
+	PID      int    `json:"pid,omitempty"`
+	State    string `json:"state,omitempty"` // server state: stopped, starting, running, stopping or crashed
+	Restarts int    `json:"restarts"`
+	LastExit string `json:"last_exit,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runStatus implements `miner status [--json]`.
+func runStatus(args []string, logger *slog.Logger) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the status as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: miner status [--json]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	defer assets.Cleanup(cfg.TempAssets)
+
+	report := collectStatus(cfg, logger)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printStatus(report)
+	}
+	// Scripts and monitoring rely on the exit code
+	if !report.OK {
+		return fmt.Errorf("Miner is not healthy; run 'miner doctor' for details")
+	}
+	return nil
+}
+
+// collectStatus inspects every component Miner installs or depends on
+func collectStatus(cfg *config.Config, logger *slog.Logger) *statusReport {
+	user := userInstalled(cfg, logger)
+	r := &statusReport{Version: config.AppVersion, Scope: scopeName(user)}
+
+	r.Hosts = hostsStatus{Path: cfg.HostsPath, Domain: cfg.Domain, Required: cfg.NeedsHostsEntry(), ExpectedIP: cfg.Host, OK: true}
+	hostsManager := hosts.NewManager(cfg.HostsPath, logger)
+	for _, domain := range cfg.HostsDomains() {
+		mappings, err := hostsManager.Mappings(domain)
+		if err != nil {
+			r.Hosts.Error, r.Hosts.OK = err.Error(), false
+			break
+		}
+		for _, ip := range cfg.HostIPs() {
+			e := hostsEntryStatus{Domain: domain, ExpectedIP: ip}
+			if got, ok := hosts.Resolve(mappings, ip); ok {
+				e.IP, e.Managed = got.IP, got.Managed
+				e.OK = net.ParseIP(got.IP).Equal(net.ParseIP(ip))
+			}
+			r.Hosts.Entries = append(r.Hosts.Entries, e)
+			r.Hosts.OK = r.Hosts.OK && e.OK
+		}
+	}
+	if r.Hosts.Error == "" {
+		if mappings, err := hostsManager.Mappings(cfg.Domain); err != nil {
+			r.Hosts.Error, r.Hosts.OK = err.Error(), false
+		} else if got, ok := hosts.Resolve(mappings, cfg.Host); ok {
+			r.Hosts.Present, r.Hosts.IP, r.Hosts.Managed = true, got.IP, got.Managed
+		}
+	}
+
+	cliManager, svc, svcErr := newManagers(cfg, user, logger)
+	r.CLI = cliStatus{Dir: cliManager.BinDir(), Commands: cliManager.Installed(), OnPath: cliManager.OnPath()}
+	r.CLI.Registered = true
+	for _, ok := range r.CLI.Commands {
+		r.CLI.Registered = r.CLI.Registered && ok
+	}
+
+	r.Service.State = "unknown"
+	if svcErr != nil {
+		r.Service.Error = svcErr.Error()
+	} else if state, err := svc.Status(); err != nil {
+		r.Service.Installed = true
+		r.Service.Error = err.Error()
+	} else {
+		r.Service.State = strings.ReplaceAll(strings.ToLower(state), " ", "-")
+		r.Service.Installed = r.Service.State != "not-installed"
+		r.Service.Running = r.Service.State == "running"
+	}
+
+	if path, err := config.FrankenPHPPath(); err != nil {
+		r.FrankenPHP.Error = "frankenphp not found in a managed store or PATH"
+	} else {
+		r.FrankenPHP.Found = true
+		r.FrankenPHP.Path = path
+		for _, dir := range config.FrankenPHPDirs() {
+			r.FrankenPHP.Managed = r.FrankenPHP.Managed || path == frankenphp.NewStore(dir, logger).CurrentBinary()
+		}
+		if r.FrankenPHP.Version, err = frankenphp.CheckVersion(runner.Exec{}, path); err != nil {
+			r.FrankenPHP.Error = err.Error()
+		}
+	}
+
+	r.Assets = assetsStatus{Dir: cfg.AssetsDir, Source: "filesystem"}
+	if cfg.TempAssets != "" {
+		r.Assets.Source = "embedded"
+	}
+	var err error
+	if r.Adminer.Version, err = assets.AdminerVersion(cfg.AssetsDir); err != nil {
+		r.Adminer.Error = err.Error()
+	}
+
+	r.Server.URL = cfg.ActiveURL()
+	if client, err := config.DialInstance(); err == nil {
+		if st, err := client.Status(); err != nil {
+			r.Instance.Error = err.Error()
+		} else {
+			r.Instance = instanceStatus{Running: true, Mode: st.Mode, PID: st.PID, State: st.State, Restarts: st.Restarts, LastExit: st.LastExit}
+			r.Server.URL = st.URL
+		}
+	} else if !errors.Is(err, control.ErrNoInstance) {
+		r.Instance.Error = err.Error()
+	}
+	if !r.Instance.Running {
+		// An instance without a reachable control socket still holds its lock
+		for _, path := range []string{config.LockFile(), filepath.Join(config.SystemRuntimeDir(), instance.LockName)} {
+			if owner, held := instance.Check(path); held {
+				r.Instance.Running, r.Instance.Mode, r.Instance.PID = true, owner.Mode, owner.PID
+				break
+			}
+		}
+	}
+	if err := probeURL(r.Server.URL); err != nil {
+		r.Server.Error = err.Error()
+	} else {
+		r.Server.Reachable = true
+	}
+
+	r.OK = r.Hosts.OK && r.CLI.Registered && r.FrankenPHP.Found && r.Adminer.Error == "" && r.Server.Reachable
+	return r
+}
+
+// probeURL checks that Adminer answers at u, connecting via the loopback
+// address so that a missing hosts entry is reported separately.
+func probeURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	secure := parsed.Scheme == "https"
+	port := parsed.Port()
+	if port == "" {
+		port = "80"
+		if secure {
+			port = "443"
+		}
+	}
+	return server.Probe(parsed.Hostname(), port, secure)
+}
+
+func printStatus(r *statusReport) {
+	mark := func(ok bool) string {
+		if ok {
+			return "✓"
+		}
+		return "✗"
+	}
+
+	fmt.Printf("Miner v%s (%s install)\n\n", r.Version, r.Scope)
+
+	switch {
+	case r.Hosts.Error != "":
+		fmt.Printf("%s Hosts entry: %s\n", mark(false), r.Hosts.Error)
+	case !r.Hosts.Required:
+		fmt.Printf("%s Hosts entry: not needed for %s\n", mark(true), r.Hosts.Domain)
+	default:
+		for _, e := range r.Hosts.Entries {
+			switch {
+			case e.IP == "":
+				fmt.Printf("%s Hosts entry: %s -> %s missing from %s\n", mark(false), e.Domain, e.ExpectedIP, r.Hosts.Path)
+				continue
+			case e.OK:
+				fmt.Printf("%s Hosts entry: %s -> %s", mark(true), e.Domain, e.IP)
+			default:
+				fmt.Printf("%s Hosts entry: %s -> %s (expected %s)", mark(false), e.Domain, e.IP, e.ExpectedIP)
+			}
+			if !e.Managed {
+				fmt.Print(" (not managed by Miner)")
+			}
+			fmt.Println()
+		}
+	}
+
+	var missing []string
+	for _, name := range cli.Commands {
+		if !r.CLI.Commands[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Printf("%s CLI commands: %s in %s", mark(true), strings.Join(cli.Commands, ", "), r.CLI.Dir)
+	} else {
+		fmt.Printf("%s CLI commands: %s missing from %s", mark(false), strings.Join(missing, ", "), r.CLI.Dir)
+	}
+	if !r.CLI.OnPath {
+		fmt.Print(" (not on PATH)")
+	}
+	fmt.Println()
+
+	fmt.Printf("%s Service: %s", mark(r.Service.Running), strings.ReplaceAll(r.Service.State, "-", " "))
+	if r.Service.Error != "" {
+		fmt.Printf(" (%s)", r.Service.Error)
+	}
+	fmt.Println()
+
+	switch {
+	case !r.FrankenPHP.Found:
+		fmt.Printf("%s FrankenPHP: not found in a managed store or PATH\n", mark(false))
+	case r.FrankenPHP.Version == "":
+		fmt.Printf("%s FrankenPHP: %s (version unknown: %s)\n", mark(true), r.FrankenPHP.Path, r.FrankenPHP.Error)
+	case r.FrankenPHP.Error != "":
+		fmt.Printf("%s FrankenPHP: %s\n", mark(false), r.FrankenPHP.Error)
+	default:
+		fmt.Printf("%s FrankenPHP: %s (v%s)\n", mark(true), r.FrankenPHP.Path, r.FrankenPHP.Version)
+	}
+
+	fmt.Printf("%s Assets: %s (%s)\n", mark(r.Adminer.Error == ""), r.Assets.Dir, r.Assets.Source)
+	if r.Adminer.Error != "" {
+		fmt.Printf("%s Adminer: %s\n", mark(false), r.Adminer.Error)
+	} else {
+		fmt.Printf("%s Adminer: v%s\n", mark(true), r.Adminer.Version)
+	}
+
+	switch {
+	case r.Instance.Running:
+		if r.Instance.State == "" {
+			fmt.Printf("%s Instance: %s (pid %d), control socket unreachable\n", mark(false), r.Instance.Mode, r.Instance.PID)
+			break
+		}
+		fmt.Printf("%s Instance: %s (pid %d), server %s", mark(r.Instance.State == "running"), r.Instance.Mode, r.Instance.PID, r.Instance.State)
+		if r.Instance.Restarts > 0 {
+			fmt.Printf(", restarted %d times", r.Instance.Restarts)
+		}
+		fmt.Println()
+	case r.Instance.Error != "":
+		fmt.Printf("%s Instance: %s\n", mark(false), r.Instance.Error)
+	default:
+		fmt.Printf("%s Instance: none running\n", mark(false))
+	}
+
+	if r.Server.Reachable {
+		fmt.Printf("%s Server: %s answers\n", mark(true), r.Server.URL)
+	} else {
+		fmt.Printf("%s Server: %s not answering (%s)\n", mark(false), r.Server.URL, r.Server.Error)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/cli"
+	"github.com/4nkitd/miner/internal/config"
+	"github.com/4nkitd/miner/internal/elevation"
+	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+func runUninstall(args []string, logger *slog.Logger) error {
+	opts, err := parseInstallFlags("uninstall", args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if opts.dryRun {
+		fmt.Println("Uninstalling Miner (dry run)...")
+	} else {
+		fmt.Println("Uninstalling Miner...")
+	}
+	fmt.Println()
+
+	// Check for elevation; a per-user install only elevates for the hosts entry
+	if opts.user && elevation.IsElevated() {
+		// Under sudo or pkexec, do it for the user who ran it
+		if ran, err := runAsInvokingUser(); ran || err != nil {
+			return err
+		}
+		return fmt.Errorf("--user uninstalls for the invoking user; run it without sudo")
+	}
+	if !opts.user && !opts.dryRun && !elevation.IsElevated() {
+		fmt.Println("Uninstallation requires administrator/root privileges.")
+		return elevation.RequestElevation(runner.Exec{})
+	}
+
+	// Load configuration
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return err
+	}
+	if opts.domain != "" {
+		cfg.Domain = opts.domain
+	}
+
+	u := &uninstaller{cfg: cfg, opts: opts, logger: logger}
+	if err := u.Uninstall(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if opts.dryRun {
+		fmt.Println("Nothing was changed (--dry-run).")
+	} else {
+		fmt.Println("✓ Uninstallation complete!")
+	}
+	return nil
+}
+
+// uninstaller undoes what `miner install` did by replaying its manifest in
+// reverse. Installs made before the manifest existed fall back to removing
+// the default components.
+type uninstaller struct {
+	cfg    *config.Config
+	opts   *installOptions
+	logger *slog.Logger
+}
+
+// uninstallStep is one change to undo
+type uninstallStep struct {
+	desc string
+	run  func() error
+}
+
+// Uninstall removes every recorded change, or only lists them with --dry-run
+func (u *uninstaller) Uninstall() error {
+	path := config.SystemManifestFile()
+	if u.opts.user {
+		path = config.ManifestFile()
+	}
+	m, err := manifest.Load(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var steps []uninstallStep
+	if m != nil {
+		u.logger.Debug("replaying install manifest", "path", m.Path(), "changes", len(m.Changes))
+		steps = u.manifestSteps(m)
+	} else {
+		u.logger.Debug("no install manifest; removing default components", "path", path)
+		if steps, err = u.legacySteps(); err != nil {
+			return err
+		}
+	}
+
+	if u.opts.dryRun {
+		if len(steps) == 0 {
+			fmt.Println("Nothing to remove.")
+			return nil
+		}
+		fmt.Println("The following would be removed:")
+		for _, step := range steps {
+			fmt.Printf("  - %s\n", step.desc)
+		}
+		return nil
+	}
+
+	for _, step := range steps {
+		fmt.Printf("✓ Removing %s\n", step.desc)
+		if err := step.run(); err != nil {
+			fmt.Printf("  Warning: %v\n", err)
+		}
+	}
+	if m != nil {
+		// Changes that could not be undone stay listed for the next attempt
+		return m.Save()
+	}
+	return nil
+}
+
+// manifestSteps undoes the recorded changes, latest first
+func (u *uninstaller) manifestSteps(m *manifest.Manifest) []uninstallStep {
+	var steps []uninstallStep
+	for _, c := range m.Reverse() {
+		if u.skip(c) {
+			continue
+		}
+		c := c
+		steps = append(steps, uninstallStep{desc: c.String(), run: func() error {
+			if err := u.undo(c, m.Scope == scopeName(true)); err != nil {
+				return err
+			}
+			m.Forget(c)
+			return nil
+		}})
+	}
+	return steps
+}
+
+// skip reports whether the uninstall flags exclude c
+func (u *uninstaller) skip(c manifest.Change) bool {
+	switch c.Component {
+	case manifest.ComponentHosts:
+		return u.opts.noHosts || (u.opts.domain != "" && c.Value != u.opts.domain)
+	case manifest.ComponentCLI:
+		return u.opts.noCLI
+	case manifest.ComponentService:
+		return u.opts.noService
+	case manifest.ComponentFrankenPHP:
+		return u.opts.noFrankenPHP
+	}
+	return false
+}
+
+// undo reverts a single recorded change
+func (u *uninstaller) undo(c manifest.Change, user bool) error {
+	switch c.Kind {
+	case manifest.KindFile:
+		if err := os.Remove(c.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	case manifest.KindDir:
+		if entries, err := os.ReadDir(c.Path); err == nil && len(entries) > 0 {
+			u.logger.Info("keeping directory that is not empty", "path", c.Path)
+			return nil
+		}
+		if err := os.Remove(c.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	case manifest.KindProfileLine:
+		return cli.RemoveFromProfile(c.Path, c.Value)
+	case manifest.KindProfileBlock:
+		return cli.RemoveBlock(c.Path)
+	case manifest.KindHostsEntry:
+		// Each address of a domain is recorded; the first undo removes them all
+		m := hosts.NewManager(c.Path, u.logger)
+		if !managedEntry(m, c.Value) {
+			return nil
+		}
+		if user && !elevation.IsElevated() {
+			return elevation.RunElevated(runner.Exec{}, "hosts", "remove", c.Value)
+		}
+		return m.RemoveEntry(c.Value)
+	case manifest.KindService:
+		_, svc, err := newManagers(u.cfg, c.Value == scopeName(true), u.logger)
+		if err != nil {
+			return err
+		}
+		return svc.Uninstall()
+	case manifest.KindConfigKey:
+		return config.RemoveKeys(c.Path, c.Value)
+	default:
+		return fmt.Errorf("unknown change %q", c.Kind)
+	}
+	return nil
+}
+
+// legacySteps removes the default components of an install that has no manifest
+func (u *uninstaller) legacySteps() ([]uninstallStep, error) {
+	cfg, user := u.cfg, u.opts.user
+	hostsManager := hosts.NewManager(cfg.HostsPath, u.logger)
+	cliManager, svc, err := newManagers(cfg, user, u.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service: %w", err)
+	}
+
+	var steps []uninstallStep
+	var domains []string
+	for _, domain := range cfg.HostsDomains() {
+		// A stale entry in Miner's block is still Miner's to remove
+		if has, _ := hostsManager.HasEntry(domain, cfg.HostIPs()...); has || managedEntry(hostsManager, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) > 0 && !u.opts.noHosts {
+		steps = append(steps, uninstallStep{desc: "hosts entries " + strings.Join(domains, ", "), run: func() error {
+			if user {
+				return elevation.RunElevated(runner.Exec{}, append([]string{"hosts", "remove"}, domains...)...)
+			}
+			for _, domain := range domains {
+				if err := hostsManager.RemoveEntry(domain); err != nil {
+					return err
+				}
+			}
+			return nil
+		}})
+	}
+	if !u.opts.noCLI {
+		steps = append(steps, uninstallStep{desc: "CLI commands in " + cliManager.BinDir(), run: cliManager.Unregister})
+	}
+	if !u.opts.noService {
+		steps = append(steps, uninstallStep{desc: scopeName(user) + " auto-start service", run: svc.Uninstall})
+	}
+	if path, err := config.UserConfigFile(); err == nil && user {
+		steps = append(steps, uninstallStep{desc: "install settings in " + path, run: func() error {
+			return config.RemoveKeys(path, "domain", "port")
+		}})
+	}
+	return steps, nil
+}
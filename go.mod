@@ -2,6 +2,12 @@ module github.com/4nkitd/miner
 
 go 1.25.1
 
+require (
+	github.com/getlantern/systray v1.2.2
+	github.com/kardianos/service v1.2.4
+	golang.org/x/sys v0.38.0
+)
+
 require (
 	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520 // indirect
 	github.com/getlantern/errors v0.0.0-20190325191628-abdb3e3e36f7 // indirect
@@ -9,10 +15,6 @@ require (
 	github.com/getlantern/hex v0.0.0-20190417191902-c6586a6fe0b7 // indirect
 	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 // indirect
 	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
-	github.com/getlantern/systray v1.2.2 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
-	github.com/kardianos/service v1.2.4 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
-	github.com/txn2/txeh v1.5.5 // indirect
-	golang.org/x/sys v0.38.0 // indirect
 )
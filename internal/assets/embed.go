@@ -3,9 +3,11 @@ package assets
 import (
 	"embed"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
 //go:embed files/*
@@ -70,3 +72,25 @@ func Cleanup(path string) error {
 	}
 	return os.RemoveAll(path)
 }
+
+// adminerVersion matches the version constant near the top of adminer.php
+var adminerVersion = regexp.MustCompile(`VERSION="([^"]+)"`)
+
+// AdminerVersion returns the version of adminer.php in dir
+func AdminerVersion(dir string) (string, error) {
+	f, err := os.Open(filepath.Join(dir, "adminer.php"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head, err := io.ReadAll(io.LimitReader(f, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	m := adminerVersion.FindSubmatch(head)
+	if m == nil {
+		return "", fmt.Errorf("no version found in %s", f.Name())
+	}
+	return string(m[1]), nil
+}
@@ -0,0 +1,25 @@
+package browser
+
+import (
+	"runtime"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// Open opens url (or a local file) with the default browser or application,
+// started with r
+func Open(r runner.Runner, url string) error {
+	var cmd *runner.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = &runner.Cmd{Path: "open", Args: []string{url}}
+	case "windows":
+		cmd = &runner.Cmd{Path: "cmd", Args: []string{"/c", "start", url}}
+	default:
+		cmd = &runner.Cmd{Path: "xdg-open", Args: []string{url}}
+	}
+
+	_, err := r.Start(cmd)
+	return err
+}
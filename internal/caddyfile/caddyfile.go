@@ -0,0 +1,144 @@
+package caddyfile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Site describes the Adminer site served by FrankenPHP
+type Site struct {
+	Domain  string   // host matched by the site block
+	Aliases []string // further hosts matched by the same block
+	Port    string
+	Root    string // document root containing adminer.php
+
+	Headers     map[string]string // response headers added to every request
+	AccessLog   string            // access log file; empty disables access logging
+	MaxBodySize string            // request body limit, e.g. "64MB"; empty means unlimited
+	Compression bool              // enable zstd/gzip response compression
+
+	// TLS certificate and key; when set the site is served over HTTPS
+	TLSCert string
+	TLSKey  string
+}
+
+// header is a single response header rendered in a stable order
+type header struct {
+	Name  string
+	Value string
+}
+
+var tmpl = template.Must(template.New("Caddyfile").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`# Generated by Miner; do not edit. Changes are overwritten on every start.
+{
+	admin off
+	auto_https off
+	frankenphp
+}
+
+{{range $i, $host := .Hosts}}{{if $i}}, {{end}}{{if $.TLSCert}}https{{else}}http{{end}}://{{$host}}:{{$.Port}}{{end}} {
+{{- if .TLSCert}}
+	tls {{quote .TLSCert}} {{quote .TLSKey}}
+{{- end}}
+	root * {{quote .Root}}
+{{- if .Compression}}
+	encode zstd gzip
+{{- end}}
+{{- if .MaxBodySize}}
+	request_body {
+		max_size {{.MaxBodySize}}
+	}
+{{- end}}
+{{- range .HeaderList}}
+	header {{.Name}} {{quote .Value}}
+{{- end}}
+{{- if .AccessLog}}
+	log {
+		output file {{quote .AccessLog}}
+	}
+{{- end}}
+	php_server
+}
+`))
+
+// Render generates the Caddyfile for site
+func Render(site Site) (string, error) {
+	if site.Domain == "" || site.Port == "" || site.Root == "" {
+		return "", fmt.Errorf("caddyfile: domain, port and root are required")
+	}
+	if !validHost(site.Domain) {
+		return "", fmt.Errorf("caddyfile: invalid domain %q", site.Domain)
+	}
+	for _, alias := range site.Aliases {
+		if !validHost(alias) {
+			return "", fmt.Errorf("caddyfile: invalid alias %q", alias)
+		}
+	}
+	// Written unquoted, so they must be single tokens
+	if !validToken(site.Port) {
+		return "", fmt.Errorf("caddyfile: invalid port %q", site.Port)
+	}
+	if site.MaxBodySize != "" && !validToken(site.MaxBodySize) {
+		return "", fmt.Errorf("caddyfile: invalid max body size %q", site.MaxBodySize)
+	}
+	if (site.TLSCert == "") != (site.TLSKey == "") {
+		return "", fmt.Errorf("caddyfile: TLS needs both a certificate and a key")
+	}
+
+	headers := make([]header, 0, len(site.Headers))
+	for name, value := range site.Headers {
+		if !validToken(name) {
+			return "", fmt.Errorf("caddyfile: invalid header name %q", name)
+		}
+		// A newline would end the directive, even inside quotes, and a
+		// backslash could escape the closing quote
+		if hasControl(value) || strings.Contains(value, `\`) {
+			return "", fmt.Errorf("caddyfile: invalid value of header %s: %q", name, value)
+		}
+		headers = append(headers, header{Name: name, Value: value})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		Site
+		Hosts      []string
+		HeaderList []header
+	}{site, append([]string{site.Domain}, site.Aliases...), headers})
+	if err != nil {
+		return "", fmt.Errorf("caddyfile: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// quote returns s as a Caddyfile double-quoted token. Only quotes need
+// escaping; Caddy keeps other backslashes (e.g. Windows paths) literally.
+// A backslash before a quote, or at the end, would escape the quote that
+// follows it, so such values are refused.
+func quote(s string) (string, error) {
+	if strings.HasSuffix(s, `\`) || strings.Contains(s, `\"`) {
+		return "", fmt.Errorf("cannot quote %q", s)
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`, nil
+}
+
+// validHost reports whether host can be written as the host of a site address
+func validHost(host string) bool {
+	return validToken(host) && !strings.ContainsAny(host, ",/:")
+}
+
+// validToken reports whether s is a single unquoted Caddyfile token that
+// cannot open or close a block
+func validToken(s string) bool {
+	return s != "" && !hasControl(s) && !strings.ContainsAny(s, " {}\"#`")
+}
+
+// hasControl reports whether s contains a control character such as a newline
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
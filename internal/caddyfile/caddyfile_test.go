@@ -0,0 +1,67 @@
+package caddyfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func testSite() Site {
+	return Site{Domain: "miner.test", Port: "8088", Root: "/srv/adminer"}
+}
+
+func TestRender(t *testing.T) {
+	site := testSite()
+	site.Aliases = []string{"db.test"}
+	site.Headers = map[string]string{"X-Frame-Options": "DENY", "Content-Security-Policy": `default-src 'self'; img-src "data:"`}
+	site.MaxBodySize = "64MB"
+
+	got, err := Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"http://miner.test:8088, http://db.test:8088 {\n",
+		"\troot * \"/srv/adminer\"\n",
+		"\t\tmax_size 64MB\n",
+		"\theader Content-Security-Policy \"default-src 'self'; img-src \\\"data:\\\"\"\n\theader X-Frame-Options \"DENY\"\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Caddyfile lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+// Values from the config file or MINER_* variables must not add directives
+func TestRenderRejectsInjection(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(*Site)
+	}{
+		{"domain with newline", func(s *Site) { s.Domain = "miner.test {\n}\nevil.test" }},
+		{"domain with space", func(s *Site) { s.Domain = "miner.test evil.test" }},
+		{"domain with brace", func(s *Site) { s.Domain = "miner.test{" }},
+		{"domain with port", func(s *Site) { s.Domain = "miner.test:80" }},
+		{"domain with comma", func(s *Site) { s.Domain = "miner.test,evil.test" }},
+		{"alias with newline", func(s *Site) { s.Aliases = []string{"db.test\nevil"} }},
+		{"port with newline", func(s *Site) { s.Port = "8088 {\n}" }},
+		{"body size with newline", func(s *Site) { s.MaxBodySize = "1MB\n\t}\n\tfile_server" }},
+		{"header name with newline", func(s *Site) { s.Headers = map[string]string{"X-A\nfile_server": "1"} }},
+		{"header value with newline", func(s *Site) { s.Headers = map[string]string{"X-A": "1\"\n\tfile_server browse\n\theader X-B \"2"} }},
+		{"header value with carriage return", func(s *Site) { s.Headers = map[string]string{"X-A": "1\r2"} }},
+		{"header value with control character", func(s *Site) { s.Headers = map[string]string{"X-A": "1\x002"} }},
+		{"header value ending in backslash", func(s *Site) {
+			s.Headers = map[string]string{"X-A": `x\`, "X-B": ` file_server browse`}
+		}},
+		{"header value with backslash", func(s *Site) { s.Headers = map[string]string{"X-A": `a\"b`} }},
+		{"root ending in backslash", func(s *Site) { s.Root = `C:\adminer\` }},
+		{"access log with escaped quote", func(s *Site) { s.AccessLog = `/tmp/a\" file_server "` }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			site := testSite()
+			tt.modify(&site)
+			if out, err := Render(site); err == nil {
+				t.Errorf("Render accepted it:\n%s", out)
+			}
+		})
+	}
+}
@@ -2,55 +2,178 @@ package cli
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/elevation"
+	"github.com/4nkitd/miner/internal/logging"
+	"github.com/4nkitd/miner/internal/manifest"
 )
 
 // Manager handles CLI command registration
 type Manager struct {
 	binaryPath string
+	frankenphp string // managed FrankenPHP binary the wrappers prefer over PATH
+	user       bool   // per-user install into ~/.local/bin
+	rec        manifest.Recorder
+	owner      *elevation.User // user whose home and files are edited when run via sudo
+	log        *slog.Logger
 }
 
-// NewManager creates a new CLI manager
-func NewManager(binaryPath string) *Manager {
+// NewManager creates a new CLI manager; a nil logger uses slog.Default()
+func NewManager(binaryPath string, logger *slog.Logger) *Manager {
 	return &Manager{
 		binaryPath: binaryPath,
+		log:        logging.OrDefault(logger),
 	}
 }
 
-// Register registers CLI commands (php, fphp, miner) in system PATH
-func (m *Manager) Register() error {
-	baseDir := filepath.Dir(m.binaryPath)
-	binDir := ""
+// SetUser switches to a per-user install: on Unix the wrappers go to
+// ~/.local/bin, PATH is only extended through shell profiles and Unregister
+// removes the wrappers but not the directory
+func (m *Manager) SetUser(user bool) {
+	m.user = user
+}
+
+// SetFrankenPHP makes the php and fphp wrappers run the FrankenPHP binary at
+// path when it exists, falling back to frankenphp in PATH
+func (m *Manager) SetFrankenPHP(path string) {
+	m.frankenphp = path
+}
+
+// SetOwner edits the shell profiles and per-user files of u instead of those of
+// the current (root) user, and gives any files it creates to u
+func (m *Manager) SetOwner(u *elevation.User) {
+	m.owner = u
+}
+
+// homeDir returns the home of the owner, or of the current user
+func (m *Manager) homeDir() (string, error) {
+	if m.owner != nil {
+		return m.owner.Home, nil
+	}
+	return os.UserHomeDir()
+}
+
+// chown gives a file created in the owner's home to the owner
+func (m *Manager) chown(path string) {
+	if err := m.owner.Chown(path); err != nil {
+		m.log.Warn("failed to change owner", "path", path, "err", err)
+	}
+}
+
+// SetRecorder records the files and profile lines Register creates
+func (m *Manager) SetRecorder(rec manifest.Recorder) {
+	m.rec = rec
+}
+
+// record passes a change made by Register to the recorder, if any
+func (m *Manager) record(kind, path, value string) {
+	if m.rec != nil {
+		m.rec.Record(manifest.Change{Component: manifest.ComponentCLI, Kind: kind, Path: path, Value: value})
+	}
+}
+
+// Commands are the wrapper commands installed by Register
+var Commands = []string{"php", "fphp", "miner"}
+
+// BinDir returns the directory the wrapper commands are installed to
+func (m *Manager) BinDir() string {
 	if runtime.GOOS == "windows" {
 		// On Windows keep wrappers next to the binary by default
+		baseDir := filepath.Dir(m.binaryPath)
 		if filepath.Base(baseDir) == "bin" {
-			binDir = baseDir
-		} else {
-			binDir = filepath.Join(baseDir, "bin")
+			return baseDir
 		}
-	} else {
-		// On Unix/macOS, install to a stable system-wide location
-		binDir = "/usr/local/miner/bin"
+		return filepath.Join(baseDir, "bin")
 	}
+	if m.user {
+		if home, err := m.homeDir(); err == nil {
+			return filepath.Join(home, ".local", "bin")
+		}
+	}
+	// On Unix/macOS, install to a stable system-wide location
+	return "/usr/local/miner/bin"
+}
 
-	// Create bin directory if it doesn't exist
-	if err := os.MkdirAll(binDir, 0755); err != nil {
-		return fmt.Errorf("failed to create bin directory: %w", err)
+// Installed returns which wrapper commands exist in BinDir. In user mode only
+// wrappers written by Register count, as ~/.local/bin is shared.
+func (m *Manager) Installed() map[string]bool {
+	installed := make(map[string]bool, len(Commands))
+	for _, name := range Commands {
+		_, err := os.Stat(m.wrapperPath(name, m.BinDir()))
+		installed[name] = err == nil && (!m.user || m.ownsWrapper(name, m.BinDir()))
 	}
+	return installed
+}
 
-	// Create wrapper scripts for each command
-	commands := map[string]string{
-		"php":   m.getPHPScript(),
-		"fphp":  m.getFPHPScript(),
-		"miner": m.getMinerScript(),
+// OnPath reports whether BinDir is listed in the current PATH
+func (m *Manager) OnPath() bool {
+	binDir := filepath.Clean(m.BinDir())
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir != "" && filepath.Clean(dir) == binDir {
+			return true
+		}
+	}
+	return false
+}
+
+// Stale returns the installed wrapper commands whose content differs from
+// what Register writes, e.g. after the miner binary was moved
+func (m *Manager) Stale() []string {
+	var stale []string
+	scripts := m.scripts()
+	for _, name := range Commands {
+		data, err := os.ReadFile(m.wrapperPath(name, m.BinDir()))
+		if err == nil && string(data) != scripts[name] {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// EnsurePath (re)adds BinDir to the PATH of new shells without rewriting the wrappers
+func (m *Manager) EnsurePath() error {
+	if err := m.addToPath(m.BinDir()); err != nil {
+		return fmt.Errorf("failed to add to PATH: %w", err)
+	}
+	return nil
+}
+
+// Register registers CLI commands (php, fphp, miner) in system PATH
+func (m *Manager) Register() error {
+	binDir := m.BinDir()
+
+	// Create bin directory if it doesn't exist
+	if _, err := os.Stat(binDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(binDir, 0755); err != nil {
+			return fmt.Errorf("failed to create bin directory: %w", err)
+		}
+		if m.user {
+			m.chown(binDir)
+		}
+		m.record(manifest.KindDir, binDir, "")
 	}
 
-	for cmdName, scriptContent := range commands {
+	// Create wrapper scripts for each command
+	scripts := m.scripts()
+	for _, cmdName := range Commands {
+		scriptContent := scripts[cmdName]
+		if m.user && !m.ownsWrapper(cmdName, binDir) {
+			// ~/.local/bin is shared with other tools; keep their commands
+			m.log.Warn("not replacing existing command", "path", m.wrapperPath(cmdName, binDir))
+			continue
+		}
 		if err := m.createWrapper(cmdName, scriptContent, binDir); err != nil {
 			return fmt.Errorf("failed to create %s command: %w", cmdName, err)
 		}
+		if m.user {
+			m.chown(m.wrapperPath(cmdName, binDir))
+		}
+		m.record(manifest.KindFile, m.wrapperPath(cmdName, binDir), "")
 	}
 
 	// Add bin directory to PATH
@@ -63,6 +186,10 @@ func (m *Manager) Register() error {
 
 // Unregister removes CLI commands from system PATH
 func (m *Manager) Unregister() error {
+	if m.user {
+		return m.unregisterUser()
+	}
+
 	binDir := ""
 	if runtime.GOOS == "windows" {
 		binDir = filepath.Join(filepath.Dir(m.binaryPath), "bin")
@@ -71,6 +198,7 @@ func (m *Manager) Unregister() error {
 	}
 
 	// Remove bin directory
+	m.log.Debug("removing CLI wrappers", "dir", binDir)
 	if err := os.RemoveAll(binDir); err != nil {
 		return fmt.Errorf("failed to remove bin directory: %w", err)
 	}
@@ -83,19 +211,89 @@ func (m *Manager) Unregister() error {
 	return nil
 }
 
-func (m *Manager) createWrapper(cmdName, scriptContent, binDir string) error {
-	var scriptPath string
-	var scriptExt string
+// unregisterUser removes the wrappers Register wrote to the per-user bin dir
+func (m *Manager) unregisterUser() error {
+	binDir := m.BinDir()
+	for _, name := range Commands {
+		if _, err := os.Stat(m.wrapperPath(name, binDir)); err != nil || !m.ownsWrapper(name, binDir) {
+			continue
+		}
+		m.log.Debug("removing CLI wrapper", "path", m.wrapperPath(name, binDir))
+		if err := os.Remove(m.wrapperPath(name, binDir)); err != nil {
+			return fmt.Errorf("failed to remove %s command: %w", name, err)
+		}
+	}
 
+	if err := m.removeFromPath(binDir); err != nil {
+		return fmt.Errorf("failed to remove from PATH: %w", err)
+	}
+	return nil
+}
+
+// ownsWrapper reports whether the command in binDir is missing or is a
+// wrapper script written by Register (and not, say, the miner binary itself)
+func (m *Manager) ownsWrapper(cmdName, binDir string) bool {
+	path := m.wrapperPath(cmdName, binDir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if same, _ := sameFile(path, m.binaryPath); same {
+		return false
+	}
+	script := m.scripts()[cmdName]
+	header, _, _ := strings.Cut(script, "\n")
+	content := string(data)
+	return content == script || (strings.HasPrefix(content, header+"\n") &&
+		(strings.Contains(content, "frankenphp") || strings.Contains(content, m.binaryPath)))
+}
+
+// sameFile reports whether a and b name the same file
+func sameFile(a, b string) (bool, error) {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ia, ib), nil
+}
+
+// RemoveFromProfile removes the first occurrence of text, as appended by
+// Register, from the shell profile at path
+func RemoveFromProfile(path, text string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	if !strings.Contains(content, text) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Replace(content, text, "", 1)), info.Mode().Perm())
+}
+
+func (m *Manager) wrapperPath(cmdName, binDir string) string {
 	if runtime.GOOS == "windows" {
-		scriptExt = ".bat"
-	} else {
-		scriptExt = ""
+		return filepath.Join(binDir, cmdName+".bat")
 	}
+	return filepath.Join(binDir, cmdName)
+}
 
-	scriptPath = filepath.Join(binDir, cmdName+scriptExt)
+func (m *Manager) createWrapper(cmdName, scriptContent, binDir string) error {
+	scriptPath := m.wrapperPath(cmdName, binDir)
 
 	// Write script file
+	m.log.Debug("writing CLI wrapper", "path", scriptPath)
 	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
 		return err
 	}
@@ -103,24 +301,45 @@ func (m *Manager) createWrapper(cmdName, scriptContent, binDir string) error {
 	return nil
 }
 
-func (m *Manager) getPHPScript() string {
-	if runtime.GOOS == "windows" {
-		return "@echo off\nfrankenphp php-cli %*"
+// scripts returns the content of each wrapper command
+func (m *Manager) scripts() map[string]string {
+	return map[string]string{
+		"php":   m.getPHPScript(),
+		"fphp":  m.getFPHPScript(),
+		"miner": m.getMinerScript(),
 	}
+}
+
+func (m *Manager) getPHPScript() string {
 	// Minimal alias-like wrapper to FrankenPHP's php-cli
-	return "#!/bin/sh\nexec frankenphp php-cli \"$@\""
+	return m.frankenphpScript("php-cli ")
 }
 
 func (m *Manager) getFPHPScript() string {
+	return m.frankenphpScript("")
+}
+
+// frankenphpScript runs FrankenPHP with the given leading arguments, preferring
+// the managed binary (which follows `miner frankenphp use`)
+func (m *Manager) frankenphpScript(args string) string {
 	if runtime.GOOS == "windows" {
-		return "@echo off\nfrankenphp %*"
+		if m.frankenphp == "" {
+			return fmt.Sprintf("@echo off\nfrankenphp %s%%*", args)
+		}
+		return fmt.Sprintf("@echo off\nif exist \"%s\" (\"%s\" %s%%*) else (frankenphp %s%%*)", m.frankenphp, m.frankenphp, args, args)
+	}
+	if m.frankenphp == "" {
+		return fmt.Sprintf("#!/bin/sh\nexec frankenphp %s\"$@\"", args)
 	}
-	return "#!/bin/sh\nexec frankenphp \"$@\""
+	return fmt.Sprintf("#!/bin/sh\nbin='%s'\n[ -x \"$bin\" ] || bin=frankenphp\nexec \"$bin\" %s\"$@\"", m.frankenphp, args)
 }
 
 func (m *Manager) getMinerScript() string {
+	// Forward subcommands; a bare `miner` delegates to `miner open`, which
+	// resolves the URL of the running instance (including any fallback port)
+	// at invocation time
 	if runtime.GOOS == "windows" {
-		return "@echo off\nstart http://miner.local"
+		return fmt.Sprintf("@echo off\nif \"%%~1\"==\"\" (\"%s\" open) else (\"%s\" %%*)", m.binaryPath, m.binaryPath)
 	}
-	return "#!/bin/sh\nopen http://miner.local:88 2>/dev/null || xdg-open http://miner.local:88 2>/dev/null || sensible-browser http://miner.local:88"
+	return fmt.Sprintf("#!/bin/sh\n[ $# -eq 0 ] && set -- open\nexec '%s' \"$@\"", m.binaryPath)
 }
@@ -7,37 +7,62 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/manifest"
 )
 
-func (m *Manager) addToPath(binDir string) error {
-	// Create a file in /etc/paths.d/ (requires root)
-	pathFile := "/etc/paths.d/miner"
+// pathsFile adds the bin directory to the PATH of login shells on macOS
+const pathsFile = "/etc/paths.d/miner"
+
+// profileDFile does the same for login shells on Linux, which has no paths.d
+const profileDFile = "/etc/profile.d/miner.sh"
 
-	// Write the bin directory path
-	if err := os.WriteFile(pathFile, []byte(binDir+"\n"), 0644); err != nil {
-		return fmt.Errorf("failed to create path file: %w", err)
+func (m *Manager) addToPath(binDir string) error {
+	// Create a file in /etc/paths.d/ or /etc/profile.d/ (requires root)
+	if !m.user {
+		if err := m.addSystemPath(binDir); err != nil {
+			return err
+		}
 	}
 
-	// Also add to user shell profiles for immediate effect
-	home, err := os.UserHomeDir()
-	if err == nil {
-		profiles := []string{
-			filepath.Join(home, ".zshrc"),
-			filepath.Join(home, ".bashrc"),
-			filepath.Join(home, ".bash_profile"),
+	// Also add to user shell profiles for immediate effect; missing profiles
+	// are not created
+	for _, profile := range m.shellProfiles() {
+		// Replace the unmarked line written by earlier versions
+		if err := RemoveFromProfile(profile, profileLine(binDir)); err != nil {
+			m.log.Warn("failed to update shell profile", "path", profile, "err", err)
+			continue
+		}
+		changed, err := writeBlock(profile, shBlock(binDir), false)
+		if err != nil {
+			m.log.Warn("failed to update shell profile", "path", profile, "err", err)
+			continue
 		}
+		if changed {
+			m.log.Debug("updated PATH block in shell profile", "path", profile)
+		}
+		if blockContains(profile, binDir) {
+			m.record(manifest.KindProfileBlock, profile, "")
+		}
+	}
 
-		exportLine := fmt.Sprintf("\n# Miner CLI\nexport PATH=\"%s:$PATH\"\n", binDir)
-
-		for _, profile := range profiles {
-			if _, err := os.Stat(profile); err == nil {
-				// Append to existing profile
-				f, err := os.OpenFile(profile, os.O_APPEND|os.O_WRONLY, 0644)
-				if err != nil {
-					continue
-				}
-				f.WriteString(exportLine)
-				f.Close()
+	// fish reads every file in conf.d; only set it up if fish is configured
+	if fishDir := m.fishConfDir(); fishDir != "" {
+		if info, err := os.Stat(filepath.Dir(fishDir)); err == nil && info.IsDir() {
+			path := filepath.Join(fishDir, "miner.fish")
+			if _, err := os.Stat(fishDir); os.IsNotExist(err) {
+				m.record(manifest.KindDir, fishDir, "")
+			}
+			if err := os.MkdirAll(fishDir, 0755); err != nil {
+				m.log.Warn("failed to create fish conf.d", "path", fishDir, "err", err)
+			} else if _, err := writeBlock(path, fishBlock(binDir), true); err != nil {
+				m.log.Warn("failed to write fish config", "path", path, "err", err)
+			} else {
+				m.log.Debug("updated fish PATH config", "path", path)
+				m.chown(fishDir)
+				m.chown(path)
+				m.record(manifest.KindFile, path, "")
 			}
 		}
 	}
@@ -45,26 +70,110 @@ func (m *Manager) addToPath(binDir string) error {
 	return nil
 }
 
+// addSystemPath adds binDir to the PATH of every login shell
+func (m *Manager) addSystemPath(binDir string) error {
+	if info, err := os.Stat(filepath.Dir(pathsFile)); err == nil && info.IsDir() {
+		if err := os.WriteFile(pathsFile, []byte(binDir+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create path file: %w", err)
+		}
+		m.record(manifest.KindFile, pathsFile, "")
+		return nil
+	}
+	if info, err := os.Stat(filepath.Dir(profileDFile)); err == nil && info.IsDir() {
+		if _, err := writeBlock(profileDFile, shBlock(binDir), true); err != nil {
+			return fmt.Errorf("failed to create %s: %w", profileDFile, err)
+		}
+		m.record(manifest.KindFile, profileDFile, "")
+	}
+	return nil
+}
+
 func (m *Manager) removeFromPath(binDir string) error {
-	// Remove from /etc/paths.d/
-	pathFile := "/etc/paths.d/miner"
-	os.Remove(pathFile)
+	// Remove the system-wide files; a per-user install never wrote them
+	if !m.user {
+		os.Remove(pathsFile)
+		if blockContains(profileDFile, binDir) {
+			os.Remove(profileDFile)
+		}
+	}
 
 	// Remove from user shell profiles
-	home, err := os.UserHomeDir()
-	if err == nil {
-		profiles := []string{
-			filepath.Join(home, ".zshrc"),
-			filepath.Join(home, ".bashrc"),
-			filepath.Join(home, ".bash_profile"),
+	for _, profile := range m.shellProfiles() {
+		if !blockContains(profile, binDir) {
+			continue
 		}
-
-		for _, profile := range profiles {
-			// This is simplified - in production, you'd parse and remove the specific line
-			// For now, just notify user to manually remove if needed
-			_ = profile
+		if err := RemoveBlock(profile); err != nil {
+			m.log.Warn("failed to update shell profile", "path", profile, "err", err)
+		}
+	}
+	if fishDir := m.fishConfDir(); fishDir != "" {
+		if path := filepath.Join(fishDir, "miner.fish"); blockContains(path, binDir) {
+			os.Remove(path)
 		}
 	}
 
 	return nil
 }
+
+// profileLine is the unmarked line earlier versions appended to shell profiles
+func profileLine(binDir string) string {
+	return fmt.Sprintf("\n# Miner CLI\nexport PATH=\"%s:$PATH\"\n", binDir)
+}
+
+// shBlock is the managed block body for POSIX shells
+func shBlock(binDir string) string {
+	return fmt.Sprintf("case \":$PATH:\" in\n  *\":%s:\"*) ;;\n  *) export PATH=\"%s:$PATH\" ;;\nesac", binDir, binDir)
+}
+
+// fishBlock is the managed block body for fish
+func fishBlock(binDir string) string {
+	return fmt.Sprintf("contains -- %q $PATH; or set -gx PATH %q $PATH", binDir, binDir)
+}
+
+// PathConfigured reports whether new shells get BinDir on their PATH, via
+// /etc/paths.d, /etc/profile.d or a shell profile
+func (m *Manager) PathConfigured() bool {
+	binDir := m.BinDir()
+	if data, err := os.ReadFile(pathsFile); err == nil && strings.TrimSpace(string(data)) == binDir {
+		return true
+	}
+	if blockContains(profileDFile, binDir) {
+		return true
+	}
+	for _, profile := range m.shellProfiles() {
+		if data, err := os.ReadFile(profile); err == nil && strings.Contains(string(data), binDir) {
+			return true
+		}
+	}
+	if fishDir := m.fishConfDir(); fishDir != "" && blockContains(filepath.Join(fishDir, "miner.fish"), binDir) {
+		return true
+	}
+	return false
+}
+
+// shellProfiles returns the shell profiles of the owner (or current user)
+// that may extend PATH
+func (m *Manager) shellProfiles() []string {
+	home, err := m.homeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".zshrc"),
+		filepath.Join(home, ".bashrc"),
+		filepath.Join(home, ".bash_profile"),
+	}
+}
+
+// fishConfDir returns the conf.d dir of fish ($XDG_CONFIG_HOME/fish/conf.d).
+// XDG_CONFIG_HOME is ignored when editing the files of another user.
+func (m *Manager) fishConfDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) && m.owner == nil {
+		return filepath.Join(dir, "fish", "conf.d")
+	}
+	home, err := m.homeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "fish", "conf.d")
+}
@@ -0,0 +1,124 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/4nkitd/miner/internal/elevation"
+)
+
+// TestOwnerProfiles checks that, under sudo, the PATH setup lands in the
+// invoking user's home rather than in root's
+func TestOwnerProfiles(t *testing.T) {
+	rootHome, userHome := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", rootHome)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(rootHome, ".config"))
+	for _, home := range []string{rootHome, userHome} {
+		if err := os.WriteFile(filepath.Join(home, ".zshrc"), []byte("alias ll='ls -l'\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(home, ".config", "fish"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	owner := &elevation.User{Name: "alice", UID: os.Getuid(), GID: os.Getgid(), Home: userHome}
+	m := NewManager("/opt/miner/miner", nil)
+	m.SetUser(true)
+	m.SetOwner(owner)
+
+	binDir := filepath.Join(userHome, ".local", "bin")
+	if got := m.BinDir(); got != binDir {
+		t.Fatalf("BinDir() = %s, want %s", got, binDir)
+	}
+
+	// Registering twice must leave a single block
+	for i := 0; i < 2; i++ {
+		if err := m.Register(); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	profile := readFile(t, filepath.Join(userHome, ".zshrc"))
+	if strings.Count(profile, blockStart) != 1 || !strings.Contains(profile, binDir) {
+		t.Fatalf("user profile has no single managed block:\n%s", profile)
+	}
+	if root := readFile(t, filepath.Join(rootHome, ".zshrc")); strings.Contains(root, blockStart) {
+		t.Fatalf("root's profile was edited:\n%s", root)
+	}
+	fish := filepath.Join(userHome, ".config", "fish", "conf.d", "miner.fish")
+	if !strings.Contains(readFile(t, fish), binDir) {
+		t.Fatalf("fish config does not add %s", binDir)
+	}
+	if _, err := os.Stat(filepath.Join(rootHome, ".config", "fish", "conf.d")); !os.IsNotExist(err) {
+		t.Fatalf("fish config was written for root")
+	}
+	for _, path := range []string{binDir, filepath.Join(binDir, "php"), fish} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st := info.Sys().(*syscall.Stat_t); int(st.Uid) != owner.UID || int(st.Gid) != owner.GID {
+			t.Errorf("%s is owned by %d:%d, want %d:%d", path, st.Uid, st.Gid, owner.UID, owner.GID)
+		}
+	}
+	if !m.PathConfigured() {
+		t.Errorf("PathConfigured() = false after Register")
+	}
+
+	if err := m.Unregister(); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+	if got := readFile(t, filepath.Join(userHome, ".zshrc")); got != "alias ll='ls -l'\n" {
+		t.Fatalf("profile not restored after Unregister:\n%q", got)
+	}
+	if _, err := os.Stat(fish); !os.IsNotExist(err) {
+		t.Fatalf("fish config left behind")
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestMinerWrapperForwardsArgs checks that the miner wrapper runs subcommands
+// and opens the browser only when called without arguments
+func TestMinerWrapperForwardsArgs(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "args")
+	binary := filepath.Join(dir, "miner-bin")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\necho \"$@\" > '"+out+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := filepath.Join(dir, "miner")
+	if err := os.WriteFile(wrapper, []byte(NewManager(binary, nil).getMinerScript()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "open"},
+		{[]string{"status", "--json"}, "status --json"},
+		{[]string{"hosts", "add", "db.test"}, "hosts add db.test"},
+	} {
+		if err := exec.Command(wrapper, tt.args...).Run(); err != nil {
+			t.Fatalf("miner %v: %v", tt.args, err)
+		}
+		if got := strings.TrimSpace(readFile(t, out)); got != tt.want {
+			t.Errorf("miner %v ran the binary with %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
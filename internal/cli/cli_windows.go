@@ -6,3 +6,6 @@ package cli
 // Windows stubs: PATH modification handled differently by installer; wrappers placed in bin directory already on PATH via user configuration.
 func (m *Manager) addToPath(binDir string) error      { return nil }
 func (m *Manager) removeFromPath(binDir string) error { return nil }
+
+// PathConfigured reports whether BinDir is on the PATH
+func (m *Manager) PathConfigured() bool { return m.OnPath() }
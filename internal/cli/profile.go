@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"os"
+	"strings"
+)
+
+// Markers delimiting the block Miner manages in shell profiles
+const (
+	blockStart = "# >>> miner >>>"
+	blockEnd   = "# <<< miner <<<"
+)
+
+// managedBlock wraps body in the block markers
+func managedBlock(body string) string {
+	return blockStart + "\n" + strings.TrimRight(body, "\n") + "\n" + blockEnd + "\n"
+}
+
+// findBlock returns the byte range of the managed block in content, including
+// the newline after the end marker, or ok=false if there is none
+func findBlock(content string) (start, end int, ok bool) {
+	start = strings.Index(content, blockStart)
+	if start < 0 {
+		return 0, 0, false
+	}
+	n := strings.Index(content[start:], blockEnd)
+	if n < 0 {
+		return 0, 0, false
+	}
+	end = start + n + len(blockEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+// writeBlock puts body in the managed block of the file at path, replacing an
+// existing block in place or appending a new one. Missing files are only
+// created when create is set. It reports whether the file changed.
+func writeBlock(path, body string, create bool) (bool, error) {
+	block := managedBlock(body)
+	perm := os.FileMode(0644)
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && !create:
+		return false, nil
+	case os.IsNotExist(err):
+		data = nil
+	case err != nil:
+		return false, err
+	default:
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+
+	content := string(data)
+	var updated string
+	if start, end, ok := findBlock(content); ok {
+		updated = content[:start] + block + content[end:]
+	} else {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		updated = content + block
+	}
+	if updated == string(data) {
+		return false, nil
+	}
+	return true, os.WriteFile(path, []byte(updated), perm)
+}
+
+// RemoveBlock removes the managed block, and the blank line written before
+// it, from the file at path. A missing file or block is not an error.
+func RemoveBlock(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	start, end, ok := findBlock(content)
+	if !ok {
+		return nil
+	}
+	if strings.HasSuffix(content[:start], "\n\n") {
+		start--
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content[:start]+content[end:]), info.Mode().Perm())
+}
+
+// blockContains reports whether the managed block of the file at path
+// mentions s
+func blockContains(path, s string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	start, end, ok := findBlock(string(data))
+	return ok && strings.Contains(string(data[start:end]), s)
+}
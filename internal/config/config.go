@@ -1,11 +1,15 @@
 package config
 
 import (
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/server"
+	"github.com/4nkitd/miner/internal/tlsca"
 )
 
 const (
@@ -13,10 +17,11 @@ const (
 	AppName    = "miner"
 	AppVersion = "1.0.0"
 
-	// Server configuration
+	// Server defaults (overridable via config file or MINER_* environment)
 	ServerPort   = "88"
 	ServerDomain = "miner.local"
 	ServerHost   = "127.0.0.1"
+	ServerHost6  = "::1"
 
 	// CLI command names
 	CLICommandPHP   = "php"
@@ -27,17 +32,45 @@ const (
 // Config holds application configuration
 type Config struct {
 	Port       string
+	PortRange  string // Fallback ports tried when Port is taken, e.g. "8089-8099"
 	Domain     string
+	Aliases    []string // Extra hostnames served and mapped alongside Domain
 	Host       string
+	Host6      string // IPv6 address also mapped when Host is a loopback address; empty disables it
 	AppDir     string
 	AssetsDir  string
 	BinaryPath string
 	HostsPath  string
 	AutoStart  bool
-	TempAssets string // Path to extracted embedded assets (empty if using filesystem)
+	TempAssets string   // Path to extracted embedded assets (empty if using filesystem)
+	Sources    []string // Config files merged over the defaults, lowest precedence first
+
+	// Supervisor settings for the FrankenPHP process
+	RestartPolicy string
+	MaxRestarts   int
+
+	// Generated Caddyfile settings
+	Headers     map[string]string // Response headers added to every request
+	AccessLog   string            // Access log file (empty disables it)
+	MaxBodySize string            // Request body limit, e.g. "64MB" (empty means unlimited)
+	Compression bool
+
+	// FrankenPHP log rotation
+	LogMaxSizeMB  int
+	LogMaxAgeDays int
+	LogMaxFiles   int
+
+	// Local HTTPS
+	TLS    bool
+	TLSDir string // Local CA and certificate directory
+
+	// Directory (or file:// URL) mirroring FrankenPHP releases as
+	// v<version>/<asset>, used instead of GitHub; empty downloads from GitHub
+	FrankenPHPMirror string
 }
 
-// New creates a new configuration with defaults
+// New creates a new configuration from the defaults, merged with any config
+// files and MINER_* environment overrides (see ConfigFiles for the order).
 func New() (*Config, error) {
 	execPath, err := os.Executable()
 	if err != nil {
@@ -80,12 +113,26 @@ func New() (*Config, error) {
 		Port:       ServerPort,
 		Domain:     ServerDomain,
 		Host:       ServerHost,
+		Host6:      ServerHost6,
 		AppDir:     appDir,
 		AssetsDir:  assetsDir,
 		BinaryPath: execPath,
 		HostsPath:  getHostsPath(),
 		AutoStart:  true,
 		TempAssets: tempAssets,
+
+		RestartPolicy: string(server.RestartOnFailure),
+		MaxRestarts:   server.DefaultRestartOptions().MaxRestarts,
+		Compression:   true,
+		LogMaxSizeMB:  10,
+		LogMaxAgeDays: 7,
+		LogMaxFiles:   5,
+		TLSDir:        tlsDir(),
+	}
+
+	if err := cfg.load(); err != nil {
+		assets.Cleanup(tempAssets)
+		return nil, err
 	}
 
 	return cfg, nil
@@ -93,10 +140,84 @@ func New() (*Config, error) {
 
 // URL returns the full server URL
 func (c *Config) URL() string {
-	if c.Port == "80" {
+	switch {
+	case c.TLS && c.Port == "443":
+		return "https://" + c.Domain
+	case c.TLS:
+		return "https://" + c.Domain + ":" + c.Port
+	case c.Port == "80":
 		return "http://" + c.Domain
+	default:
+		return "http://" + c.Domain + ":" + c.Port
+	}
+}
+
+// Domains returns Domain followed by the aliases, without duplicates
+func (c *Config) Domains() []string {
+	seen := map[string]bool{}
+	var domains []string
+	for _, d := range append([]string{c.Domain}, c.Aliases...) {
+		key := strings.ToLower(d)
+		if d == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		domains = append(domains, d)
+	}
+	return domains
+}
+
+// HostsDomains returns the domains that must be mapped in the hosts file
+func (c *Config) HostsDomains() []string {
+	var domains []string
+	for _, d := range c.Domains() {
+		if needsHostsEntry(d) {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// NeedsHostsEntry reports whether any domain must be mapped in the hosts file;
+// localhost and IP addresses resolve without one
+func (c *Config) NeedsHostsEntry() bool {
+	return len(c.HostsDomains()) > 0
+}
+
+func needsHostsEntry(domain string) bool {
+	return !strings.EqualFold(domain, "localhost") && net.ParseIP(domain) == nil
+}
+
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
+}
+
+// HostIPs returns the addresses the domains are mapped to: Host, and Host6
+// when Host is a loopback address so that IPv6 lookups stay local too
+func (c *Config) HostIPs() []string {
+	ips := []string{c.Host}
+	if ip := net.ParseIP(c.Host); ip != nil && ip.IsLoopback() && c.Host6 != "" && c.Host6 != c.Host {
+		ips = append(ips, c.Host6)
+	}
+	return ips
+}
+
+// tlsDir returns where the local CA and certificates live. Root uses the
+// system config dir; other users share it once it holds a CA (created by
+// `miner trust`) and fall back to their own config dir otherwise.
+func tlsDir() string {
+	system := filepath.Join(SystemConfigDir(), "tls")
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return system
+	}
+	if _, err := os.Stat(filepath.Join(system, tlsca.CAFile)); err == nil {
+		return system
+	}
+	if dir, err := UserConfigDir(); err == nil {
+		return filepath.Join(dir, "tls")
 	}
-	return "http://" + c.Domain + ":" + c.Port
+	return system
 }
 
 // getHostsPath returns the platform-specific hosts file path
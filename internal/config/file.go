@@ -0,0 +1,451 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/server"
+)
+
+// ConfigFileName is the name of the config file looked up in each config dir
+const ConfigFileName = "config.json"
+
+// Environment variables that override values from config files
+const (
+	EnvConfig    = "MINER_CONFIG"
+	EnvPort      = "MINER_PORT"
+	EnvDomain    = "MINER_DOMAIN"
+	EnvAliases   = "MINER_ALIASES" // comma-separated
+	EnvHost      = "MINER_HOST"
+	EnvAutoStart = "MINER_AUTOSTART"
+	EnvTLS       = "MINER_TLS"
+
+	EnvFrankenPHPMirror = "MINER_FRANKENPHP_MIRROR"
+
+	// Defaults for the --log-level and --log-format flags
+	EnvLogLevel  = "MINER_LOG_LEVEL"
+	EnvLogFormat = "MINER_LOG_FORMAT"
+)
+
+// EnvVar describes a MINER_* environment variable
+type EnvVar struct {
+	Name string
+	Help string
+}
+
+// EnvVars lists every MINER_* environment variable Miner reads. They are
+// forwarded to the auto-start service and listed by `miner help`.
+var EnvVars = []EnvVar{
+	{EnvConfig, "additional config file, loaded last"},
+	{EnvPort, "port to serve Adminer on"},
+	{EnvDomain, "domain mapped in the hosts file"},
+	{EnvAliases, "further domains, comma-separated"},
+	{EnvHost, "address the domains are mapped to"},
+	{EnvAutoStart, "start automatically on login (true or false)"},
+	{EnvTLS, "serve over HTTPS (true or false)"},
+	{EnvFrankenPHPMirror, "URL or directory to download FrankenPHP from"},
+	{EnvLogLevel, "default of --log-level"},
+	{EnvLogFormat, "default of --log-format"},
+}
+
+// fileConfig is the on-disk config format. Unset fields keep the value
+// resolved from the previous layer.
+type fileConfig struct {
+	Port      *json.Number `json:"port,omitempty"`
+	PortRange *string      `json:"port_range,omitempty"`
+	Domain    *string      `json:"domain,omitempty"`
+	Aliases   []string     `json:"aliases,omitempty"`
+	Host      *string      `json:"host,omitempty"`
+	Host6     *string      `json:"host6,omitempty"`
+	AutoStart *bool        `json:"auto_start,omitempty"`
+
+	RestartPolicy *string `json:"restart_policy,omitempty"`
+	MaxRestarts   *int    `json:"max_restarts,omitempty"`
+
+	Headers     map[string]string `json:"headers,omitempty"`
+	AccessLog   *string           `json:"access_log,omitempty"`
+	MaxBodySize *string           `json:"max_body_size,omitempty"`
+	Compression *bool             `json:"compression,omitempty"`
+
+	LogMaxSizeMB  *int `json:"log_max_size_mb,omitempty"`
+	LogMaxAgeDays *int `json:"log_max_age_days,omitempty"`
+	LogMaxFiles   *int `json:"log_max_files,omitempty"`
+
+	TLS *bool `json:"tls,omitempty"`
+
+	FrankenPHPMirror *string `json:"frankenphp_mirror,omitempty"`
+}
+
+// sizePattern matches Caddy size values such as "64MB" or "1.5GiB"
+var sizePattern = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)?\s*([kmgtp]i?)?b?$`)
+
+// SystemConfigDir returns the machine-wide config directory
+func SystemConfigDir() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), AppName)
+	}
+	return filepath.Join("/etc", AppName)
+}
+
+// UserConfigDir returns the per-user config directory ($XDG_CONFIG_HOME/miner)
+func UserConfigDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, AppName), nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, AppName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", AppName), nil
+}
+
+// SystemConfigFile returns the path of the machine-wide config file
+func SystemConfigFile() string {
+	return filepath.Join(SystemConfigDir(), ConfigFileName)
+}
+
+// UserConfigFile returns the path of the per-user config file
+func UserConfigFile() (string, error) {
+	dir, err := UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ConfigFileName), nil
+}
+
+// ConfigFiles returns the config files consulted by New, lowest precedence first:
+// the system-wide file, the per-user file and the file named by MINER_CONFIG.
+func ConfigFiles() []string {
+	files := []string{SystemConfigFile()}
+	if path, err := UserConfigFile(); err == nil {
+		files = append(files, path)
+	}
+	if path := os.Getenv(EnvConfig); path != "" {
+		files = append(files, path)
+	}
+	return files
+}
+
+// load merges config files and environment overrides over the defaults in c.
+// Precedence (highest last): defaults, system file, user file, MINER_CONFIG
+// file, MINER_* environment variables.
+func (c *Config) load() error {
+	for _, path := range ConfigFiles() {
+		ok, err := c.loadFile(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.Sources = append(c.Sources, path)
+		}
+	}
+	return c.applyEnv()
+}
+
+// loadFile merges a single config file into c. Missing files are skipped,
+// except the one explicitly named by MINER_CONFIG.
+func (c *Config) loadFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && path != os.Getenv(EnvConfig) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return false, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if fc.Port != nil {
+		if err := c.SetPort(fc.Port.String()); err != nil {
+			return false, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if fc.PortRange != nil {
+		if *fc.PortRange != "" {
+			if _, _, err := server.ParsePortRange(*fc.PortRange); err != nil {
+				return false, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		}
+		c.PortRange = *fc.PortRange
+	}
+	if fc.Domain != nil {
+		if err := hosts.ValidateHostname(*fc.Domain); err != nil {
+			return false, fmt.Errorf("invalid config file %s: domain: %w", path, err)
+		}
+		c.Domain = *fc.Domain
+	}
+	if fc.Aliases != nil {
+		for _, alias := range fc.Aliases {
+			if err := hosts.ValidateHostname(alias); err != nil {
+				return false, fmt.Errorf("invalid config file %s: aliases: %w", path, err)
+			}
+		}
+		c.Aliases = fc.Aliases
+	}
+	if fc.Host != nil {
+		c.Host = *fc.Host
+	}
+	if fc.Host6 != nil {
+		if *fc.Host6 != "" && !isIPv6(*fc.Host6) {
+			return false, fmt.Errorf("invalid config file %s: host6 must be an IPv6 address, got %q", path, *fc.Host6)
+		}
+		c.Host6 = *fc.Host6
+	}
+	if fc.AutoStart != nil {
+		c.AutoStart = *fc.AutoStart
+	}
+	if fc.RestartPolicy != nil {
+		if _, err := server.ParseRestartPolicy(*fc.RestartPolicy); err != nil {
+			return false, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		c.RestartPolicy = *fc.RestartPolicy
+	}
+	if fc.MaxRestarts != nil {
+		if *fc.MaxRestarts < 0 {
+			return false, fmt.Errorf("invalid config file %s: max_restarts must not be negative", path)
+		}
+		c.MaxRestarts = *fc.MaxRestarts
+	}
+	if fc.Headers != nil {
+		// Headers merge across files; an empty value removes a header set by a lower layer
+		if c.Headers == nil {
+			c.Headers = map[string]string{}
+		}
+		for name, value := range fc.Headers {
+			if value == "" {
+				delete(c.Headers, name)
+			} else {
+				c.Headers[name] = value
+			}
+		}
+	}
+	if fc.AccessLog != nil {
+		c.AccessLog = *fc.AccessLog
+	}
+	if fc.MaxBodySize != nil {
+		if *fc.MaxBodySize != "" && !sizePattern.MatchString(*fc.MaxBodySize) {
+			return false, fmt.Errorf("invalid config file %s: invalid max_body_size %q", path, *fc.MaxBodySize)
+		}
+		c.MaxBodySize = *fc.MaxBodySize
+	}
+	if fc.Compression != nil {
+		c.Compression = *fc.Compression
+	}
+	for _, v := range []struct {
+		key string
+		src *int
+		dst *int
+	}{
+		{"log_max_size_mb", fc.LogMaxSizeMB, &c.LogMaxSizeMB},
+		{"log_max_age_days", fc.LogMaxAgeDays, &c.LogMaxAgeDays},
+		{"log_max_files", fc.LogMaxFiles, &c.LogMaxFiles},
+	} {
+		if v.src == nil {
+			continue
+		}
+		if *v.src < 0 {
+			return false, fmt.Errorf("invalid config file %s: %s must not be negative", path, v.key)
+		}
+		*v.dst = *v.src
+	}
+	if fc.TLS != nil {
+		c.TLS = *fc.TLS
+	}
+	if fc.FrankenPHPMirror != nil {
+		c.FrankenPHPMirror = *fc.FrankenPHPMirror
+	}
+	return true, nil
+}
+
+// applyEnv applies MINER_* environment variable overrides
+func (c *Config) applyEnv() error {
+	if v := os.Getenv(EnvPort); v != "" {
+		if err := c.SetPort(v); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPort, err)
+		}
+	}
+	if v := os.Getenv(EnvDomain); v != "" {
+		if err := hosts.ValidateHostname(v); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvDomain, err)
+		}
+		c.Domain = v
+	}
+	if v := os.Getenv(EnvAliases); v != "" {
+		c.Aliases = nil
+		for _, alias := range strings.Split(v, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				if err := hosts.ValidateHostname(alias); err != nil {
+					return fmt.Errorf("invalid %s: %w", EnvAliases, err)
+				}
+				c.Aliases = append(c.Aliases, alias)
+			}
+		}
+	}
+	if v := os.Getenv(EnvHost); v != "" {
+		c.Host = v
+	}
+	if v := os.Getenv(EnvAutoStart); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvAutoStart, err)
+		}
+		c.AutoStart = b
+	}
+	if v := os.Getenv(EnvTLS); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvTLS, err)
+		}
+		c.TLS = b
+	}
+	if v := os.Getenv(EnvFrankenPHPMirror); v != "" {
+		c.FrankenPHPMirror = v
+	}
+	return nil
+}
+
+// SetPort validates and sets the server port
+func (c *Config) SetPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %q", port)
+	}
+	c.Port = strconv.Itoa(n)
+	return nil
+}
+
+// settings returns the persistable settings of c keyed by their config file name
+func (c *Config) settings() map[string]any {
+	port, _ := strconv.Atoi(c.Port)
+	return map[string]any{
+		"port":       port,
+		"port_range": c.PortRange,
+		"domain":     c.Domain,
+		"aliases":    c.Aliases,
+		"host":       c.Host,
+		"host6":      c.Host6,
+		"auto_start": c.AutoStart,
+
+		"restart_policy": c.RestartPolicy,
+		"max_restarts":   c.MaxRestarts,
+
+		"headers":       c.Headers,
+		"access_log":    c.AccessLog,
+		"max_body_size": c.MaxBodySize,
+		"compression":   c.Compression,
+
+		"log_max_size_mb":  c.LogMaxSizeMB,
+		"log_max_age_days": c.LogMaxAgeDays,
+		"log_max_files":    c.LogMaxFiles,
+
+		"tls": c.TLS,
+
+		"frankenphp_mirror": c.FrankenPHPMirror,
+	}
+}
+
+// SaveTo writes the named settings (config file keys) of c into the config file
+// at path, keeping any other settings already present in that file.
+func (c *Config) SaveTo(path string, keys ...string) error {
+	values := map[string]any{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	current := c.settings()
+	for _, key := range keys {
+		v, ok := current[key]
+		if !ok {
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+		values[key] = v
+	}
+
+	out, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// RemoveKeys deletes the named settings from the config file at path and
+// removes the file once it holds no settings. A missing file is not an error.
+func RemoveKeys(path string, keys ...string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for _, key := range keys {
+		delete(values, key)
+	}
+	if len(values) == 0 {
+		return os.Remove(path)
+	}
+
+	out, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// envOverrides returns the MINER_* variables set in the current environment,
+// so that processes spawned on our behalf resolve the same config.
+func envOverrides() map[string]string {
+	env := map[string]string{}
+	for _, ev := range EnvVars {
+		key := ev.Name
+		if v := os.Getenv(key); v != "" {
+			if key == EnvConfig && !filepath.IsAbs(v) {
+				if abs, err := filepath.Abs(v); err == nil {
+					v = abs
+				}
+			}
+			env[key] = v
+		}
+	}
+	return env
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A domain ends up in the hosts file, so one that could add lines is refused
+func TestLoadRejectsInvalidDomain(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{"domain with newline", `{"domain": "miner.test\n0.0.0.0 bank.example"}`, nil},
+		{"domain with space", `{"domain": "miner.test evil.test"}`, nil},
+		{"alias with newline", `{"aliases": ["db.test", "db.test\nevil"]}`, nil},
+		{"MINER_DOMAIN with space", `{}`, map[string]string{EnvDomain: "miner.test 0.0.0.0"}},
+		{"MINER_ALIASES with newline", `{}`, map[string]string{EnvAliases: "db.test,evil\n0.0.0.0"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			c := &Config{}
+			_, err := c.loadFile(path)
+			if err == nil {
+				err = c.applyEnv()
+			}
+			if err == nil {
+				t.Errorf("accepted domain %q, aliases %q", c.Domain, c.Aliases)
+			}
+		})
+	}
+}
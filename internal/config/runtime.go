@@ -0,0 +1,255 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/control"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/instance"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// urlFileName holds the URL of the running instance inside a runtime dir
+const urlFileName = "url"
+
+// FrankenPHPLogName is the name of the current FrankenPHP log file
+const FrankenPHPLogName = "frankenphp.log"
+
+// RuntimeDir returns the directory for runtime state (active URL, locks,
+// sockets) of the current process: /run/miner when running as root,
+// $XDG_RUNTIME_DIR/miner otherwise, falling back to a per-user dir in the
+// temp dir. Create it with EnsureRuntimeDir.
+func RuntimeDir() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.TempDir(), AppName)
+	}
+	if os.Geteuid() == 0 {
+		return SystemRuntimeDir()
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, AppName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", AppName, os.Getuid()))
+}
+
+// SystemRuntimeDir returns the runtime dir used by root-owned instances such
+// as the system service.
+func SystemRuntimeDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.TempDir(), AppName)
+	case "linux":
+		return filepath.Join("/run", AppName)
+	default:
+		return filepath.Join("/var/run", AppName)
+	}
+}
+
+// StateDir returns the directory for persistent state of the current process:
+// /var/lib/miner when running as root, $XDG_STATE_HOME/miner otherwise.
+func StateDir() string {
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, AppName)
+		}
+		return filepath.Join(os.TempDir(), AppName)
+	}
+	if os.Geteuid() == 0 {
+		return SystemStateDir()
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, AppName)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", AppName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", AppName, os.Getuid()))
+}
+
+// SystemStateDir returns the state dir used by root, e.g. by `sudo miner install`
+func SystemStateDir() string {
+	if runtime.GOOS == "windows" {
+		return StateDir()
+	}
+	return filepath.Join("/var/lib", AppName)
+}
+
+// DataDir returns the directory for data Miner manages, such as FrankenPHP
+// versions: /var/lib/miner when running as root, $XDG_DATA_HOME/miner
+// otherwise.
+func DataDir() string {
+	if runtime.GOOS == "windows" {
+		return StateDir()
+	}
+	if os.Geteuid() == 0 {
+		return SystemDataDir()
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, AppName)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", AppName)
+	}
+	return StateDir()
+}
+
+// SystemDataDir returns the data dir used by root
+func SystemDataDir() string {
+	if runtime.GOOS == "windows" {
+		return DataDir()
+	}
+	return filepath.Join("/var/lib", AppName)
+}
+
+// FrankenPHPDir returns the FrankenPHP store of the current process
+func FrankenPHPDir() string {
+	return filepath.Join(DataDir(), "frankenphp")
+}
+
+// SystemFrankenPHPDir returns the FrankenPHP store of a system-wide install
+func SystemFrankenPHPDir() string {
+	return filepath.Join(SystemDataDir(), "frankenphp")
+}
+
+// FrankenPHPDirs returns the FrankenPHP stores consulted by FrankenPHPPath:
+// the current user's first and the system one second
+func FrankenPHPDirs() []string {
+	dirs := []string{FrankenPHPDir()}
+	if sys := SystemFrankenPHPDir(); sys != dirs[0] {
+		dirs = append(dirs, sys)
+	}
+	return dirs
+}
+
+// FrankenPHPPath returns the FrankenPHP binary to run: the version in use in
+// a managed store, else frankenphp from PATH
+func FrankenPHPPath() (string, error) {
+	return frankenphp.Resolve(runner.Exec{}, FrankenPHPDirs()...)
+}
+
+// ManifestFile returns the install manifest of the current process: written
+// by `sudo miner install` under /var/lib/miner, by `miner install --user`
+// under the user's state dir
+func ManifestFile() string {
+	return filepath.Join(StateDir(), manifest.FileName)
+}
+
+// SystemManifestFile returns the manifest of a system-wide install
+func SystemManifestFile() string {
+	return filepath.Join(SystemStateDir(), manifest.FileName)
+}
+
+// LogDir returns where FrankenPHP output is logged: /var/log/miner when
+// running as root, <state dir>/logs otherwise.
+func LogDir() string {
+	if runtime.GOOS != "windows" && os.Geteuid() == 0 {
+		return filepath.Join("/var/log", AppName)
+	}
+	return filepath.Join(StateDir(), "logs")
+}
+
+// LogFile returns the current FrankenPHP log file of this process
+func (c *Config) LogFile() string {
+	return filepath.Join(LogDir(), FrankenPHPLogName)
+}
+
+// LogFiles returns the candidate FrankenPHP log files, the current user's
+// first and the system instance's second.
+func LogFiles() []string {
+	files := []string{filepath.Join(LogDir(), FrankenPHPLogName)}
+	if runtime.GOOS != "windows" {
+		if sys := filepath.Join("/var/log", AppName, FrankenPHPLogName); sys != files[0] {
+			files = append(files, sys)
+		}
+	}
+	return files
+}
+
+// ControlSocket returns the control socket served by this process
+func ControlSocket() string {
+	return filepath.Join(RuntimeDir(), control.SocketName)
+}
+
+// LockFile returns the instance lock of this process's runtime dir
+func LockFile() string {
+	return filepath.Join(RuntimeDir(), instance.LockName)
+}
+
+// AcquireLock takes the instance lock for mode (tray, daemon or service). An
+// unprivileged instance also backs off while the system service holds the
+// system lock, because both would serve the same port.
+func AcquireLock(mode string) (*instance.Lock, error) {
+	if _, err := EnsureRuntimeDir(); err != nil {
+		return nil, err
+	}
+	if sys := filepath.Join(SystemRuntimeDir(), instance.LockName); sys != LockFile() {
+		if owner, held := instance.Check(sys); held {
+			return nil, &instance.LockedError{Path: sys, Owner: owner}
+		}
+	}
+	return instance.Acquire(LockFile(), mode)
+}
+
+// runtimeDirs returns the runtime dirs to search for a running instance, the
+// current user's first.
+func runtimeDirs() []string {
+	dirs := []string{RuntimeDir()}
+	if sys := SystemRuntimeDir(); sys != dirs[0] {
+		dirs = append(dirs, sys)
+	}
+	return dirs
+}
+
+// EnsureRuntimeDir creates the runtime dir of this process and makes sure no
+// other user controls it: the fallback under the shared temp dir could have
+// been created first by anyone. A user's dir is private (0700); the system
+// dir stays readable (0755) so that users find the system service in it.
+func EnsureRuntimeDir() (string, error) {
+	dir := RuntimeDir()
+	perm := os.FileMode(0700)
+	if dir == SystemRuntimeDir() {
+		perm = 0755
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return "", fmt.Errorf("failed to create runtime dir: %w", err)
+	}
+	if err := checkRuntimeDir(dir, perm); err != nil {
+		return "", fmt.Errorf("refusing to use runtime dir %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// RecordURL publishes the URL of the running server for other processes
+// (e.g. the `miner` CLI wrapper) to find.
+func RecordURL(url string) error {
+	dir, err := EnsureRuntimeDir()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, urlFileName), []byte(url+"\n"), 0644)
+}
+
+// ClearURL removes the URL published by RecordURL
+func ClearURL() {
+	os.Remove(filepath.Join(RuntimeDir(), urlFileName))
+}
+
+// ActiveURL returns the URL published by a running instance, falling back to
+// the configured URL when none is running.
+func (c *Config) ActiveURL() string {
+	for _, dir := range runtimeDirs() {
+		data, err := os.ReadFile(filepath.Join(dir, urlFileName))
+		if err != nil {
+			continue
+		}
+		if url := strings.TrimSpace(string(data)); url != "" {
+			return url
+		}
+	}
+	return c.URL()
+}
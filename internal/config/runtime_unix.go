@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkRuntimeDir verifies that dir is a real directory owned by this user
+// with mode perm. A dir of ours that is too open but not writable by others
+// is tightened; anything else is refused.
+func checkRuntimeDir(dir string, perm os.FileMode) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("not owned by uid %d", os.Getuid())
+	}
+	if info.Mode().Perm() == perm {
+		return nil
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("mode %#o is writable by other users", info.Mode().Perm())
+	}
+	return os.Chmod(dir, perm)
+}
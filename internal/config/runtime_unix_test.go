@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRuntimeDir(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		setup func(dir string) error
+		ok    bool
+	}{
+		{"private", func(dir string) error { return os.Mkdir(dir, 0700) }, true},
+		{"tightened", func(dir string) error { return os.Mkdir(dir, 0755) }, true},
+		{"writable by others", func(dir string) error {
+			if err := os.Mkdir(dir, 0700); err != nil {
+				return err
+			}
+			return os.Chmod(dir, 0777)
+		}, false},
+		{"symlink", func(dir string) error {
+			target := dir + "-target"
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+			return os.Symlink(target, dir)
+		}, false},
+		{"file", func(dir string) error { return os.WriteFile(dir, nil, 0600) }, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "miner")
+			if err := tt.setup(dir); err != nil {
+				t.Fatal(err)
+			}
+			err := checkRuntimeDir(dir, 0700)
+			if (err == nil) != tt.ok {
+				t.Fatalf("checkRuntimeDir = %v, want ok %v", err, tt.ok)
+			}
+			if info, _ := os.Lstat(dir); tt.ok && info.Mode().Perm() != 0700 {
+				t.Errorf("mode = %#o, want 0700", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+// Another user creating the dir first must not get to control it
+func TestCheckRuntimeDirOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create a dir owned by another user")
+	}
+	dir := filepath.Join(t.TempDir(), "miner")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(dir, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRuntimeDir(dir, 0700); err == nil {
+		t.Error("accepted a dir owned by another user")
+	}
+}
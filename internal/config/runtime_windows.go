@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package config
+
+import "os"
+
+// checkRuntimeDir accepts dir: the temp dir is already per-user on Windows
+func checkRuntimeDir(dir string, perm os.FileMode) error {
+	return nil
+}
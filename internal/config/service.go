@@ -1,36 +1,60 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"time"
 
 	"github.com/4nkitd/miner/internal/assets"
+	"github.com/4nkitd/miner/internal/caddyfile"
+	"github.com/4nkitd/miner/internal/control"
 	"github.com/4nkitd/miner/internal/hosts"
+	"github.com/4nkitd/miner/internal/instance"
+	"github.com/4nkitd/miner/internal/logfile"
+	"github.com/4nkitd/miner/internal/logging"
 	"github.com/4nkitd/miner/internal/server"
 	"github.com/kardianos/service"
 )
 
 type MinerService struct {
-	cfg *Config
+	cfg    *Config
+	user   bool
+	logger *slog.Logger
 }
 
-func NewService(cfg *Config) (*MinerService, error) {
-	return &MinerService{cfg: cfg}, nil
+// NewService creates the auto-start service manager; a nil logger uses slog.Default()
+func NewService(cfg *Config, logger *slog.Logger) (*MinerService, error) {
+	return &MinerService{cfg: cfg, logger: logging.OrDefault(logger)}, nil
+}
+
+// SetUser installs the service for the current user (a systemd --user unit
+// or a LaunchAgent) instead of system-wide
+func (m *MinerService) SetUser(user bool) {
+	m.user = user
 }
 
 func (m *MinerService) baseConfig() *service.Config {
+	var opts service.KeyValue
+	if m.user {
+		opts = service.KeyValue{"UserService": true}
+	}
 	return &service.Config{
 		Name:        AppName,
 		DisplayName: "Miner Database Manager",
 		Description: "Adminer database manager powered by FrankenPHP",
+		Arguments:   []string{"service"},
+		// Forward MINER_* overrides so the service resolves the same config as the installer
+		EnvVars: envOverrides(),
+		Option:  opts,
 	}
 }
 
 func (m *MinerService) Install() error {
 	svcConfig := m.baseConfig()
-	prg := &program{cfg: m.cfg}
+	prg := &program{cfg: m.cfg, logger: m.logger}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		return err
@@ -40,7 +64,7 @@ func (m *MinerService) Install() error {
 
 func (m *MinerService) Uninstall() error {
 	svcConfig := m.baseConfig()
-	prg := &program{cfg: m.cfg}
+	prg := &program{cfg: m.cfg, logger: m.logger}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		return err
@@ -50,7 +74,7 @@ func (m *MinerService) Uninstall() error {
 
 func (m *MinerService) Start() error {
 	svcConfig := m.baseConfig()
-	prg := &program{cfg: m.cfg}
+	prg := &program{cfg: m.cfg, logger: m.logger}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		return err
@@ -58,14 +82,29 @@ func (m *MinerService) Start() error {
 	return s.Start()
 }
 
+// Run runs the service under the system service manager and blocks until it is stopped
+func (m *MinerService) Run() error {
+	svcConfig := m.baseConfig()
+	prg := &program{cfg: m.cfg, logger: m.logger}
+	s, err := service.New(prg, svcConfig)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
+
+// Status returns "Running", "Stopped", "Not installed" or "Unknown"
 func (m *MinerService) Status() (string, error) {
 	svcConfig := m.baseConfig()
-	prg := &program{cfg: m.cfg}
+	prg := &program{cfg: m.cfg, logger: m.logger}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		return "", err
 	}
 	status, err := s.Status()
+	if errors.Is(err, service.ErrNotInstalled) {
+		return "Not installed", nil
+	}
 	if err != nil {
 		return "Unknown", err
 	}
@@ -79,9 +118,151 @@ func (m *MinerService) Status() (string, error) {
 	}
 }
 
+// NewServer creates a supervised server.Server from the resolved configuration;
+// a nil logger uses slog.Default(). Processes that serve with it call Attach.
+func NewServer(cfg *Config, logger *slog.Logger) *server.Server {
+	logger = logging.OrDefault(logger)
+	srv := server.NewServer(cfg.Port, cfg.Domain, cfg.AssetsDir)
+	srv.SetLogger(logger.With("component", "server"))
+	configure(srv, cfg, logger)
+	return srv
+}
+
+// Attach sends the FrankenPHP output of srv to the rotating log file of cfg
+// and records the URL of srv while it runs. The returned func undoes both;
+// call it once srv is stopped.
+func Attach(srv *server.Server, cfg *Config, logger *slog.Logger) (detach func()) {
+	logger = logging.OrDefault(logger)
+	logw, err := logfile.Open(cfg.LogFile(), logfile.Options{
+		MaxSize:  int64(cfg.LogMaxSizeMB) << 20,
+		MaxAge:   time.Duration(cfg.LogMaxAgeDays) * 24 * time.Hour,
+		MaxFiles: cfg.LogMaxFiles,
+	})
+	if err != nil {
+		logger.Warn("FrankenPHP output will not be logged to a file", "err", err)
+	} else {
+		srv.SetLog(logw)
+		srv.SetConsole(false)
+	}
+	transitions, unsubscribe := srv.Subscribe()
+	go publishURL(srv, transitions, logger)
+	return func() {
+		unsubscribe()
+		if logw != nil {
+			logw.Close()
+		}
+	}
+}
+
+// configure applies the settings of cfg that take effect on the next start
+func configure(srv *server.Server, cfg *Config, logger *slog.Logger) {
+	var aliases []string
+	if domains := cfg.Domains(); len(domains) > 1 {
+		aliases = domains[1:]
+	}
+	srv.SetAddress(cfg.Port, cfg.Domain, aliases...)
+	if path, err := FrankenPHPPath(); err == nil {
+		srv.SetBinary(path)
+	}
+	restart := server.DefaultRestartOptions()
+	restart.Policy = server.RestartPolicy(cfg.RestartPolicy)
+	restart.MaxRestarts = cfg.MaxRestarts
+	srv.SetRestartOptions(restart)
+	srv.SetSite(caddyfile.Site{
+		Headers:     cfg.Headers,
+		AccessLog:   cfg.AccessLog,
+		MaxBodySize: cfg.MaxBodySize,
+		Compression: cfg.Compression,
+	}, filepath.Join(RuntimeDir(), "Caddyfile"))
+	if cfg.TLS {
+		srv.SetTLS(cfg.TLSDir)
+	} else {
+		srv.SetTLS("")
+	}
+	srv.SetPortRange(0, 0)
+	if cfg.PortRange != "" {
+		if first, last, err := server.ParsePortRange(cfg.PortRange); err == nil {
+			srv.SetPortRange(first, last)
+		} else {
+			logger.Warn("ignoring invalid port_range", "port_range", cfg.PortRange, "err", err)
+		}
+	}
+}
+
+// Reload re-reads the configuration and restarts srv with it if it is
+// running. The assets srv was created with keep being served.
+func Reload(srv *server.Server, logger *slog.Logger) error {
+	cfg, err := New()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	assets.Cleanup(cfg.TempAssets)
+
+	wasRunning := srv.IsRunning()
+	if err := srv.Stop(); err != nil && !errors.Is(err, server.ErrNotRunning) {
+		return err
+	}
+	configure(srv, cfg, logging.OrDefault(logger))
+	if !wasRunning {
+		return nil
+	}
+	return srv.Start()
+}
+
+// ServeControl exposes srv on the control socket of this process so that
+// `miner status`, `miner stop` and friends reach it instead of starting a
+// second server.
+func ServeControl(srv *server.Server, mode string, logger *slog.Logger) (*control.Server, error) {
+	logger = logging.OrDefault(logger)
+	if _, err := EnsureRuntimeDir(); err != nil {
+		return nil, err
+	}
+	reload := func() error { return Reload(srv, logger) }
+	return control.Listen(ControlSocket(), mode, srv, reload, logger.With("component", "control"))
+}
+
+// DialInstance connects to the control socket of a running instance, the
+// current user's first, then the system service's.
+func DialInstance() (*control.Client, error) {
+	var denied error
+	for _, dir := range runtimeDirs() {
+		client, err := control.Dial(filepath.Join(dir, control.SocketName))
+		if err == nil {
+			return client, nil
+		}
+		if errors.Is(err, fs.ErrPermission) && denied == nil {
+			denied = fmt.Errorf("a Miner instance owned by another user is running (%s); rerun with sudo", filepath.Join(dir, control.SocketName))
+		}
+	}
+	if denied != nil {
+		return nil, denied
+	}
+	return nil, control.ErrNoInstance
+}
+
+// publishURL records the URL of srv while it is running so that other
+// processes find the port actually in use, which may be a fallback port.
+func publishURL(srv *server.Server, transitions <-chan server.Transition, logger *slog.Logger) {
+	for t := range transitions {
+		logger.Debug("server state changed", "from", t.From, "to", t.To)
+		switch t.To {
+		case server.StateRunning:
+			if err := RecordURL(srv.URL()); err != nil {
+				logger.Warn("failed to record server URL", "err", err)
+			}
+		case server.StateStopped, server.StateCrashed:
+			ClearURL()
+		}
+	}
+}
+
 type program struct {
 	cfg     *Config
+	logger  *slog.Logger
 	srv     *server.Server
+	ctl     *control.Server
+	detach  func()
+	lock    *instance.Lock
 	tempDir string
 }
 
@@ -94,34 +275,67 @@ func (p *program) Start(s service.Service) error {
 	p.cfg = cfg
 	p.tempDir = cfg.TempAssets
 
+	// Refuse to start a second server next to a running tray or daemon
+	if p.lock, err = AcquireLock(control.ModeService); err != nil {
+		assets.Cleanup(cfg.TempAssets)
+		return err
+	}
+
 	// Ensure hosts entry exists (service may start before install finished)
-	hm := hosts.NewManager(cfg.HostsPath)
-	if has, _ := hm.HasEntry(cfg.Domain); !has {
-		_ = hm.AddEntry(cfg.Domain, cfg.Host)
+	hm := hosts.NewManager(cfg.HostsPath, p.logger)
+	for _, domain := range cfg.HostsDomains() {
+		if has, _ := hm.HasEntry(domain, cfg.HostIPs()...); has {
+			continue
+		}
+		// Rewriting Miner's block cannot fix an entry the user wrote
+		if owner, _ := hm.Ownership(domain); owner == hosts.User {
+			p.logger.Warn("hosts entry not managed by Miner does not match", "domain", domain, "path", cfg.HostsPath)
+			continue
+		}
+		if err := hm.AddEntry(domain, cfg.HostIPs()...); err != nil {
+			p.logger.Warn("failed to add hosts entry", "domain", domain, "err", err)
+		}
 	}
 
-	p.srv = server.NewServer(cfg.Port, cfg.Domain, cfg.AssetsDir)
+	p.srv = NewServer(cfg, p.logger)
+	p.detach = Attach(p.srv, cfg, p.logger)
+	if p.ctl, err = ServeControl(p.srv, control.ModeService, p.logger); err != nil {
+		p.logger.Warn("control socket unavailable", "err", err)
+	}
 	if err := p.srv.Start(); err != nil {
+		// Let the service manager retry: it must not find our lock or socket
+		p.shutdown()
 		return fmt.Errorf("service server start failed: %w", err)
 	}
-
-	go p.waitSignals()
+	// service.Run handles SIGINT and SIGTERM itself and calls Stop
 	return nil
 }
 
-func (p *program) waitSignals() {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	<-c
-	_ = p.Stop(nil)
+func (p *program) Stop(s service.Service) error {
+	p.shutdown()
+	return nil
 }
 
-func (p *program) Stop(s service.Service) error {
-	if p.srv != nil && p.srv.IsRunning() {
-		_ = p.srv.Stop()
+// shutdown stops the server, whatever its state, and releases everything
+// Start acquired
+func (p *program) shutdown() {
+	if p.ctl != nil {
+		p.ctl.Close()
+		p.ctl = nil
+	}
+	if p.srv != nil {
+		// Also ends a supervisor waiting to restart a crashed server
+		if err := p.srv.Stop(); err != nil && !errors.Is(err, server.ErrNotRunning) {
+			p.logger.Warn("failed to stop server", "err", err)
+		}
+	}
+	if p.detach != nil {
+		p.detach()
+		p.detach = nil
 	}
 	if p.tempDir != "" {
 		_ = assets.Cleanup(p.tempDir)
+		p.tempDir = ""
 	}
-	return nil
+	p.lock.Release()
 }
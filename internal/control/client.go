@@ -0,0 +1,101 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrNoInstance is returned by Dial when no instance serves the socket
+var ErrNoInstance = errors.New("no running Miner instance")
+
+// requestTimeout bounds control requests; start and restart wait for
+// FrankenPHP to become ready, so this exceeds server.DefaultReadyTimeout
+const requestTimeout = 60 * time.Second
+
+// Client talks to the control socket of a running Miner instance
+type Client struct {
+	path string
+	http *http.Client
+}
+
+// Dial connects to the control socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%w at %s: %w", ErrNoInstance, path, err)
+	}
+	conn.Close()
+
+	return &Client{
+		path: path,
+		http: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}, nil
+}
+
+// Path returns the path of the control socket
+func (c *Client) Path() string {
+	return c.path
+}
+
+// Status returns the state of the instance
+func (c *Client) Status() (*Status, error) {
+	return c.do(http.MethodGet, "status")
+}
+
+// Start starts the server of the instance
+func (c *Client) Start() (*Status, error) {
+	return c.do(http.MethodPost, "start")
+}
+
+// Stop stops the server; the instance keeps running and can start it again
+func (c *Client) Stop() (*Status, error) {
+	return c.do(http.MethodPost, "stop")
+}
+
+// Restart stops and starts the server
+func (c *Client) Restart() (*Status, error) {
+	return c.do(http.MethodPost, "restart")
+}
+
+// Reload makes the instance re-read its configuration and restart the server
+func (c *Client) Reload() (*Status, error) {
+	return c.do(http.MethodPost, "reload")
+}
+
+func (c *Client) do(method, action string) (*Status, error) {
+	req, err := http.NewRequest(method, "http://miner/"+action, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("control request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return nil, errors.New(e.Error)
+		}
+		return nil, fmt.Errorf("control request failed: %s", resp.Status)
+	}
+	var st Status
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, fmt.Errorf("invalid control response: %w", err)
+	}
+	return &st, nil
+}
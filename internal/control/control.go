@@ -0,0 +1,175 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/4nkitd/miner/internal/server"
+)
+
+// SocketName is the name of the control socket inside a runtime dir
+const SocketName = "control.sock"
+
+// Modes identify the kind of process serving the control socket
+const (
+	ModeTray    = "tray"
+	ModeDaemon  = "daemon"
+	ModeService = "service"
+)
+
+// Controller is the server managed through the control socket
+type Controller interface {
+	Start() error
+	Stop() error
+	Restart() error
+	Status() server.Status
+	URL() string
+}
+
+// Status is the response of GET /status and of every successful action
+type Status struct {
+	Mode      string `json:"mode"`       // tray, daemon or service
+	PID       int    `json:"pid"`        // PID of the Miner process
+	State     string `json:"state"`      // server state, see server.State
+	URL       string `json:"url"`        // URL of the (last) running server
+	Port      string `json:"port"`       // port in use, which may be a fallback port
+	ServerPID int    `json:"server_pid"` // PID of FrankenPHP; 0 unless running
+	Restarts  int    `json:"restarts"`
+	LastExit  string `json:"last_exit,omitempty"`
+}
+
+// Server serves the control API for one Miner process on a Unix socket
+type Server struct {
+	path   string
+	mode   string
+	ctl    Controller
+	reload func() error
+	log    *slog.Logger
+	http   *http.Server
+}
+
+// Listen creates the control socket at path, readable and writable by its
+// owner only, and serves ctl on it. reload re-reads the configuration and
+// applies it; nil disables POST /reload.
+func Listen(path, mode string, ctl Controller, reload func() error, logger *slog.Logger) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create control socket dir: %w", err)
+	}
+	// Bind with a umask that leaves the socket owner-only from the start, so
+	// no one connects before the chmod below
+	var ln net.Listener
+	var err error
+	withUmask(0077, func() { ln, err = listen(path) })
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &Server{path: path, mode: mode, ctl: ctl, reload: reload, log: logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /start", s.action(ctl.Start))
+	mux.HandleFunc("POST /stop", s.action(ctl.Stop))
+	mux.HandleFunc("POST /restart", s.action(ctl.Restart))
+	mux.HandleFunc("POST /reload", s.action(s.doReload))
+	s.http = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := s.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("control socket stopped", "err", err)
+		}
+	}()
+	logger.Debug("control socket listening", "path", path)
+	return s, nil
+}
+
+// listen binds path, replacing a socket left behind by a process that died
+func listen(path string) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err == nil {
+		return ln, nil
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+	if conn, dialErr := net.DialTimeout("unix", path, time.Second); dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another Miner instance is serving %s", path)
+	}
+	os.Remove(path)
+	if ln, err = net.Listen("unix", path); err != nil {
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+	return ln, nil
+}
+
+// Path returns the path of the control socket
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Close stops serving and removes the socket
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.http.Shutdown(ctx)
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := s.ctl.Status()
+	resp := Status{
+		Mode:      s.mode,
+		PID:       os.Getpid(),
+		State:     string(st.State),
+		URL:       s.ctl.URL(),
+		Port:      st.Port,
+		ServerPID: st.PID,
+		Restarts:  st.Restarts,
+	}
+	if st.LastExit != nil {
+		resp.LastExit = st.LastExit.String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) doReload() error {
+	if s.reload == nil {
+		return fmt.Errorf("reload is not supported by this instance")
+	}
+	return s.reload()
+}
+
+// action wraps a state-changing call; errors are returned as 409 Conflict
+func (s *Server) action(fn func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.log.Info("control request", "action", r.URL.Path)
+		if err := fn(); err != nil {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+			return
+		}
+		s.handleStatus(w, r)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
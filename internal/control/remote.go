@@ -0,0 +1,128 @@
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/4nkitd/miner/internal/server"
+)
+
+// remotePollInterval is how often a Remote polls for state changes
+const remotePollInterval = time.Second
+
+// Remote presents the server of another Miner process, reached through its
+// control socket, like a local *server.Server. It lets a tray attach to an
+// instance that is already running.
+type Remote struct {
+	client *Client
+
+	mu   sync.Mutex
+	last Status
+}
+
+// NewRemote returns a Remote for the instance behind client
+func NewRemote(client *Client) *Remote {
+	return &Remote{client: client}
+}
+
+func (r *Remote) Start() error   { return r.call(r.client.Start) }
+func (r *Remote) Stop() error    { return r.call(r.client.Stop) }
+func (r *Remote) Restart() error { return r.call(r.client.Restart) }
+
+func (r *Remote) call(fn func() (*Status, error)) error {
+	st, err := fn()
+	if err != nil {
+		return err
+	}
+	r.remember(st)
+	return nil
+}
+
+// refresh fetches the current status; an unreachable instance reads as stopped
+func (r *Remote) refresh() Status {
+	st, err := r.client.Status()
+	if err != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.last.State = string(server.StateStopped)
+		r.last.ServerPID = 0
+		return r.last
+	}
+	r.remember(st)
+	return *st
+}
+
+func (r *Remote) remember(st *Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = *st
+}
+
+// IsRunning reports whether the remote server is starting or running
+func (r *Remote) IsRunning() bool {
+	return r.State().Active()
+}
+
+// State returns the lifecycle state of the remote server
+func (r *Remote) State() server.State {
+	return server.State(r.refresh().State)
+}
+
+// Status returns a snapshot of the remote server; LastExit carries only the
+// exit description, not the stderr tail
+func (r *Remote) Status() server.Status {
+	st := r.refresh()
+	status := server.Status{
+		State:    server.State(st.State),
+		PID:      st.ServerPID,
+		Port:     st.Port,
+		Restarts: st.Restarts,
+	}
+	if st.LastExit != "" {
+		status.LastExit = &server.ExitStatus{Error: st.LastExit}
+	}
+	return status
+}
+
+// URL returns the URL the remote server answers on
+func (r *Remote) URL() string {
+	r.mu.Lock()
+	url := r.last.URL
+	r.mu.Unlock()
+	if url == "" {
+		url = r.refresh().URL
+	}
+	return url
+}
+
+// Subscribe polls the remote instance and emits a Transition for every state
+// change it observes. Short-lived states between polls may be missed.
+func (r *Remote) Subscribe() (<-chan server.Transition, func()) {
+	ch := make(chan server.Transition, 16)
+	quit := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(remotePollInterval)
+		defer ticker.Stop()
+		prev := server.State(r.refresh().State)
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			cur := server.State(r.refresh().State)
+			if cur == prev {
+				continue
+			}
+			select {
+			case ch <- server.Transition{From: prev, To: cur, Time: time.Now()}:
+			default:
+			}
+			prev = cur
+		}
+	}()
+	return ch, func() { once.Do(func() { close(quit) }) }
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package control
+
+import "syscall"
+
+// withUmask runs fn with the process umask set to mask, so that files it
+// creates never have more permissions than allowed by mask
+func withUmask(mask int, fn func()) {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	fn()
+}
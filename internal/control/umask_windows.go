@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package control
+
+// withUmask runs fn; Windows has no umask
+func withUmask(mask int, fn func()) {
+	fn()
+}
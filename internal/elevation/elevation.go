@@ -1,9 +1,12 @@
 package elevation
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
+
+	"github.com/4nkitd/miner/internal/logging"
+	"github.com/4nkitd/miner/internal/runner"
 )
 
 // IsElevated checks if the current process has admin/root privileges
@@ -16,8 +19,9 @@ func IsElevated() bool {
 	}
 }
 
-// RequestElevation attempts to restart the application with elevated privileges
-func RequestElevation() error {
+// RequestElevation attempts to restart the application with elevated
+// privileges, started with r
+func RequestElevation(r runner.Runner) error {
 	if IsElevated() {
 		return nil
 	}
@@ -26,18 +30,41 @@ func RequestElevation() error {
 	case "windows":
 		return requestWindowsElevation()
 	case "darwin":
-		return requestDarwinElevation()
+		return requestDarwinElevation(r)
+	default:
+		return requestLinuxElevation(r)
+	}
+}
+
+// RunElevated runs this executable with args and admin/root privileges,
+// started with r, while the current process keeps running. It waits for the
+// command to finish except on Windows, where the elevated process is only
+// launched.
+func RunElevated(r runner.Runner, args ...string) error {
+	if IsElevated() {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		return runner.Run(r, &runner.Cmd{Path: executable, Args: args, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr})
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return runWindowsElevated(args)
+	case "darwin":
+		return runDarwinElevated(r, args)
 	default:
-		return requestLinuxElevation()
+		return runLinuxElevated(r, args)
 	}
 }
 
-// CheckAndElevate checks privileges and elevates if necessary
-func CheckAndElevate() error {
+// CheckAndElevate checks privileges and elevates if necessary; a nil logger
+// uses slog.Default()
+func CheckAndElevate(r runner.Runner, logger *slog.Logger) error {
 	if !IsElevated() {
-		fmt.Println("Miner requires administrator privileges to configure hosts file and PATH.")
-		fmt.Println("Requesting elevation...")
-		return RequestElevation()
+		logging.OrDefault(logger).Info("administrator privileges are required to configure the hosts file and PATH; requesting elevation")
+		return RequestElevation(r)
 	}
 	return nil
 }
@@ -6,9 +6,11 @@ package elevation
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"runtime"
+	"strings"
 	"syscall"
+
+	"github.com/4nkitd/miner/internal/runner"
 )
 
 func isWindowsElevated() bool {
@@ -19,9 +21,26 @@ func requestWindowsElevation() error {
 	return fmt.Errorf("not on Windows")
 }
 
-func requestDarwinElevation() error {
+func runWindowsElevated(args []string) error {
+	return fmt.Errorf("not on Windows")
+}
+
+func requestDarwinElevation(r runner.Runner) error {
+	if runtime.GOOS != "darwin" {
+		return requestLinuxElevation(r)
+	}
+	if err := runDarwinElevated(r, os.Args[1:]); err != nil {
+		return err
+	}
+
+	// If elevation succeeded, exit current process
+	os.Exit(0)
+	return nil
+}
+
+func runDarwinElevated(r runner.Runner, args []string) error {
 	if runtime.GOOS != "darwin" {
-		return requestLinuxElevation()
+		return runLinuxElevated(r, args)
 	}
 
 	// On macOS, try to use osascript for graphical elevation
@@ -30,55 +49,105 @@ func requestDarwinElevation() error {
 		return err
 	}
 
-	// Build command with arguments
-	cmdLine := executable
-	for _, arg := range os.Args[1:] {
-		cmdLine += " " + arg
+	// Build command with arguments, quoted for the shell and then for AppleScript
+	cmdLine := shellQuote(executable)
+	for _, arg := range args {
+		cmdLine += " " + shellQuote(arg)
 	}
+	cmdLine = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(cmdLine)
 
 	script := fmt.Sprintf(`do shell script "%s" with administrator privileges`, cmdLine)
-	cmd := exec.Command("osascript", "-e", script)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	cmd := &runner.Cmd{Path: "osascript", Args: []string{"-e", script}, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := runner.Run(r, cmd); err != nil {
 		return fmt.Errorf("failed to elevate privileges: %w", err)
 	}
+	return nil
+}
+
+func requestLinuxElevation(r runner.Runner) error {
+	if err := runLinuxElevated(r, os.Args[1:]); err != nil {
+		return err
+	}
 
 	// If elevation succeeded, exit current process
 	os.Exit(0)
 	return nil
 }
 
-func requestLinuxElevation() error {
+func runLinuxElevated(r runner.Runner, args []string) error {
 	executable, err := os.Executable()
 	if err != nil {
 		return err
 	}
 
-	// Try pkexec first (graphical), then sudo
-	var cmd *exec.Cmd
-
-	if _, err := exec.LookPath("pkexec"); err == nil {
-		cmd = exec.Command("pkexec", append([]string{executable}, os.Args[1:]...)...)
-	} else if _, err := exec.LookPath("sudo"); err == nil {
-		cmd = exec.Command("sudo", append([]string{executable}, os.Args[1:]...)...)
+	// Try pkexec first (graphical), then sudo. Both are setuid root and do the
+	// elevation themselves, so the child is started with our own credentials.
+	cmd := &runner.Cmd{Args: append([]string{executable}, args...), Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if path, err := r.LookPath("pkexec"); err == nil {
+		cmd.Path = path
+	} else if path, err := r.LookPath("sudo"); err == nil {
+		cmd.Path = path
 	} else {
 		return fmt.Errorf("no elevation method found (pkexec or sudo required)")
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{Uid: 0, Gid: 0},
+	if err := runner.Run(r, cmd); err != nil {
+		return fmt.Errorf("failed to elevate privileges: %w", err)
 	}
+	return nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to elevate privileges: %w", err)
+// RunAs runs this executable with args as u, with the environment of a login
+// of u, started with r, and waits for it to finish
+func RunAs(r runner.Runner, u *User, args ...string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
 	}
 
-	// If elevation succeeded, exit current process
-	os.Exit(0)
-	return nil
+	return runner.Run(r, &runner.Cmd{
+		Path:   executable,
+		Args:   args,
+		Env:    userEnv(u, os.Environ()),
+		Dir:    u.Home,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: uint32(u.UID), Gid: uint32(u.GID)},
+		},
+	})
+}
+
+// userEnv returns env adjusted for u: its home and name, its runtime dir (so
+// that `systemctl --user` reaches its session) and no sudo/pkexec markers
+func userEnv(u *User, env []string) []string {
+	overrides := map[string]string{
+		"HOME":    u.Home,
+		"USER":    u.Name,
+		"LOGNAME": u.Name,
+	}
+	runtimeDir := fmt.Sprintf("/run/user/%d", u.UID)
+	if info, err := os.Stat(runtimeDir); err == nil && info.IsDir() {
+		overrides["XDG_RUNTIME_DIR"] = runtimeDir
+	}
+
+	var out []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := overrides[key]; ok || strings.HasPrefix(key, "SUDO_") || key == "PKEXEC_UID" ||
+			key == "XDG_CONFIG_HOME" || key == "XDG_STATE_HOME" || key == "XDG_RUNTIME_DIR" {
+			continue
+		}
+		out = append(out, kv)
+	}
+	for key, value := range overrides {
+		out = append(out, key+"="+value)
+	}
+	return out
+}
+
+// shellQuote quotes s for /bin/sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
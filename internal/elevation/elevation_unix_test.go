@@ -0,0 +1,107 @@
+//go:build !windows
+// +build !windows
+
+package elevation
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+func TestUserEnv(t *testing.T) {
+	u := &User{Name: "alice", UID: 1000, GID: 1000, Home: "/home/alice"}
+	env := userEnv(u, []string{
+		"HOME=/root", "USER=root", "PATH=/usr/bin", "SUDO_USER=alice", "SUDO_UID=1000",
+		"PKEXEC_UID=1000", "XDG_CONFIG_HOME=/root/.config", "MINER_PORT=8088",
+	})
+
+	got := map[string]string{}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		if _, dup := got[key]; dup {
+			t.Fatalf("duplicate variable %s", key)
+		}
+		got[key] = value
+	}
+	for key, want := range map[string]string{"HOME": "/home/alice", "USER": "alice", "LOGNAME": "alice", "PATH": "/usr/bin", "MINER_PORT": "8088"} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q", key, got[key], want)
+		}
+	}
+	for _, key := range []string{"SUDO_USER", "SUDO_UID", "PKEXEC_UID", "XDG_CONFIG_HOME"} {
+		if _, ok := got[key]; ok {
+			t.Errorf("%s must not be passed to the user", key)
+		}
+	}
+}
+
+func TestRunAs(t *testing.T) {
+	fake := runner.NewFake()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Handle(executable, runner.Exit(3, "", ""))
+	u := &User{Name: "alice", UID: 1000, GID: 1001, Home: "/home/alice"}
+
+	err = RunAs(fake, u, "install", "--user")
+	var exitErr *runner.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("RunAs = %v, want exit code 3", err)
+	}
+	started := fake.Started()
+	if len(started) != 1 {
+		t.Fatalf("started %d processes, want 1", len(started))
+	}
+	cmd := started[0].Cmd
+	if !reflect.DeepEqual(cmd.Args, []string{"install", "--user"}) || cmd.Dir != u.Home {
+		t.Errorf("ran %v in %s", cmd.Args, cmd.Dir)
+	}
+	if cred := cmd.SysProcAttr.Credential; cred.Uid != 1000 || cred.Gid != 1001 {
+		t.Errorf("credential = %d:%d, want 1000:1001", cred.Uid, cred.Gid)
+	}
+	if !slices.Contains(cmd.Env, "HOME=/home/alice") {
+		t.Errorf("environment %v lacks the user's HOME", cmd.Env)
+	}
+}
+
+func TestRunLinuxElevated(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := runner.NewFake()
+	if err := runLinuxElevated(fake, []string{"hosts", "add"}); err == nil {
+		t.Error("elevated without pkexec or sudo")
+	}
+
+	fake.Handle("/usr/bin/sudo", runner.Exit(0, "", ""))
+	if err := runLinuxElevated(fake, []string{"hosts", "add"}); err != nil {
+		t.Fatal(err)
+	}
+	fake.Handle("/usr/bin/pkexec", runner.Exit(126, "", "Not authorized\n"))
+	if err := runLinuxElevated(fake, []string{"hosts", "add"}); err == nil {
+		t.Error("a refused pkexec reported success")
+	}
+
+	var ran []string
+	for _, p := range fake.Started() {
+		ran = append(ran, p.Cmd.Path)
+		if want := []string{executable, "hosts", "add"}; !reflect.DeepEqual(p.Cmd.Args, want) {
+			t.Errorf("%s args = %v, want %v", p.Cmd.Path, p.Cmd.Args, want)
+		}
+		if p.Cmd.SysProcAttr != nil {
+			t.Errorf("%s started with SysProcAttr %+v, want none", p.Cmd.Path, p.Cmd.SysProcAttr)
+		}
+	}
+	if want := []string{"/usr/bin/sudo", "/usr/bin/pkexec"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v (pkexec preferred once available)", ran, want)
+	}
+}
@@ -6,9 +6,12 @@ package elevation
 import (
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/windows"
+
+	"github.com/4nkitd/miner/internal/runner"
 )
 
 func isWindowsElevated() bool {
@@ -38,6 +41,18 @@ func isWindowsElevated() bool {
 }
 
 func requestWindowsElevation() error {
+	if err := runWindowsElevated(os.Args[1:]); err != nil {
+		return err
+	}
+
+	// Exit current process after starting elevated one
+	os.Exit(0)
+	return nil
+}
+
+// runWindowsElevated launches the elevated process; ShellExecute does not
+// wait for it to finish
+func runWindowsElevated(args []string) error {
 	verb := "runas"
 	exe, err := os.Executable()
 	if err != nil {
@@ -49,18 +64,15 @@ func requestWindowsElevation() error {
 		return err
 	}
 
-	args := ""
-	for i, arg := range os.Args[1:] {
-		if i > 0 {
-			args += " "
-		}
-		args += arg
+	cmdArgs := make([]string, len(args))
+	for i, arg := range args {
+		cmdArgs[i] = syscall.EscapeArg(arg)
 	}
 
 	verbPtr, _ := syscall.UTF16PtrFromString(verb)
 	exePtr, _ := syscall.UTF16PtrFromString(exe)
 	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
-	argPtr, _ := syscall.UTF16PtrFromString(args)
+	argPtr, _ := syscall.UTF16PtrFromString(strings.Join(cmdArgs, " "))
 
 	var showCmd int32 = 1 // SW_NORMAL
 
@@ -68,16 +80,26 @@ func requestWindowsElevation() error {
 	if err != nil {
 		return fmt.Errorf("failed to elevate privileges: %w", err)
 	}
-
-	// Exit current process after starting elevated one
-	os.Exit(0)
 	return nil
 }
 
-func requestDarwinElevation() error {
+func requestDarwinElevation(r runner.Runner) error {
+	return fmt.Errorf("not on macOS")
+}
+
+func requestLinuxElevation(r runner.Runner) error {
+	return fmt.Errorf("not on Linux")
+}
+
+func runDarwinElevated(r runner.Runner, args []string) error {
 	return fmt.Errorf("not on macOS")
 }
 
-func requestLinuxElevation() error {
+func runLinuxElevated(r runner.Runner, args []string) error {
 	return fmt.Errorf("not on Linux")
 }
+
+// RunAs is not supported on Windows, which has no sudo
+func RunAs(r runner.Runner, u *User, args ...string) error {
+	return fmt.Errorf("running as another user is not supported on Windows")
+}
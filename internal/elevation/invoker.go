@@ -0,0 +1,88 @@
+package elevation
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+)
+
+// User is the account that started Miner through sudo or pkexec
+type User struct {
+	Name string
+	UID  int
+	GID  int
+	Home string
+}
+
+// Lookup resolves accounts from the passwd database, like os/user
+type Lookup interface {
+	Lookup(name string) (*user.User, error)
+	LookupId(uid string) (*user.User, error)
+}
+
+// systemLookup resolves accounts with os/user
+type systemLookup struct{}
+
+func (systemLookup) Lookup(name string) (*user.User, error) { return user.Lookup(name) }
+func (systemLookup) LookupId(uid string) (*user.User, error) {
+	return user.LookupId(uid)
+}
+
+// InvokingUser returns the user who ran Miner with sudo (SUDO_USER) or pkexec
+// (PKEXEC_UID), so that per-user files such as shell profiles end up in their
+// home instead of root's. It returns nil when not running as root on their
+// behalf.
+func InvokingUser() (*User, error) {
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+	return resolveInvokingUser(os.Getenv, os.Geteuid(), systemLookup{})
+}
+
+// resolveInvokingUser implements InvokingUser for the given environment,
+// effective uid and passwd lookup
+func resolveInvokingUser(getenv func(string) string, euid int, lookup Lookup) (*User, error) {
+	if euid != 0 {
+		return nil, nil
+	}
+
+	var (
+		u   *user.User
+		err error
+	)
+	switch {
+	case getenv("SUDO_USER") != "" && getenv("SUDO_USER") != "root":
+		if u, err = lookup.Lookup(getenv("SUDO_USER")); err != nil {
+			return nil, fmt.Errorf("failed to look up sudo user %s: %w", getenv("SUDO_USER"), err)
+		}
+	case getenv("PKEXEC_UID") != "" && getenv("PKEXEC_UID") != "0":
+		if u, err = lookup.LookupId(getenv("PKEXEC_UID")); err != nil {
+			return nil, fmt.Errorf("failed to look up pkexec user %s: %w", getenv("PKEXEC_UID"), err)
+		}
+	default:
+		return nil, nil
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q for user %s", u.Uid, u.Username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q for user %s", u.Gid, u.Username)
+	}
+	if u.HomeDir == "" {
+		return nil, fmt.Errorf("user %s has no home directory", u.Username)
+	}
+	return &User{Name: u.Username, UID: uid, GID: gid, Home: u.HomeDir}, nil
+}
+
+// Chown gives path to u; a nil user leaves it alone
+func (u *User) Chown(path string) error {
+	if u == nil {
+		return nil
+	}
+	return os.Lchown(path, u.UID, u.GID)
+}
@@ -0,0 +1,92 @@
+package elevation
+
+import (
+	"errors"
+	"os/user"
+	"strings"
+	"testing"
+)
+
+// fakePasswd resolves accounts from passwd(5) formatted text
+type fakePasswd string
+
+func (p fakePasswd) find(match func(fields []string) bool) (*user.User, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) == 7 && match(fields) {
+			return &user.User{Username: fields[0], Uid: fields[2], Gid: fields[3], Name: fields[4], HomeDir: fields[5]}, nil
+		}
+	}
+	return nil, errors.New("no such user")
+}
+
+func (p fakePasswd) Lookup(name string) (*user.User, error) {
+	return p.find(func(fields []string) bool { return fields[0] == name })
+}
+
+func (p fakePasswd) LookupId(uid string) (*user.User, error) {
+	return p.find(func(fields []string) bool { return fields[2] == uid })
+}
+
+const passwd = `root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/zsh
+bob:x:1001:100:Bob:/Users/bob:/usr/bin/fish
+broken:x:abc:1002::/home/broken:/bin/sh
+nohome:x:1003:1003:::/bin/sh`
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestResolveInvokingUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		euid    int
+		env     map[string]string
+		want    *User
+		wantErr bool
+	}{
+		{name: "sudo", euid: 0, env: map[string]string{"SUDO_USER": "alice"},
+			want: &User{Name: "alice", UID: 1000, GID: 1000, Home: "/home/alice"}},
+		{name: "pkexec", euid: 0, env: map[string]string{"PKEXEC_UID": "1001"},
+			want: &User{Name: "bob", UID: 1001, GID: 100, Home: "/Users/bob"}},
+		{name: "sudo wins over pkexec", euid: 0, env: map[string]string{"SUDO_USER": "alice", "PKEXEC_UID": "1001"},
+			want: &User{Name: "alice", UID: 1000, GID: 1000, Home: "/home/alice"}},
+		{name: "not root", euid: 1000, env: map[string]string{"SUDO_USER": "alice"}},
+		{name: "plain root shell", euid: 0, env: map[string]string{}},
+		{name: "sudo from root", euid: 0, env: map[string]string{"SUDO_USER": "root"}},
+		{name: "pkexec from root", euid: 0, env: map[string]string{"PKEXEC_UID": "0"}},
+		{name: "unknown user", euid: 0, env: map[string]string{"SUDO_USER": "mallory"}, wantErr: true},
+		{name: "unknown uid", euid: 0, env: map[string]string{"PKEXEC_UID": "4242"}, wantErr: true},
+		{name: "invalid uid", euid: 0, env: map[string]string{"SUDO_USER": "broken"}, wantErr: true},
+		{name: "no home", euid: 0, env: map[string]string{"SUDO_USER": "nohome"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveInvokingUser(env(tt.env), tt.euid, fakePasswd(passwd))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case tt.want == nil && got != nil:
+				t.Fatalf("expected no invoking user, got %+v", got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilUserChown(t *testing.T) {
+	var u *User
+	if err := u.Chown("/nonexistent"); err != nil {
+		t.Fatalf("nil user must not chown: %v", err)
+	}
+}
@@ -1,118 +1,321 @@
 package frankenphp
 
 import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
+
+	"github.com/4nkitd/miner/internal/logging"
+)
+
+const (
+	// DefaultBaseURL serves the release binaries as <base>/v<version>/<asset>
+	DefaultBaseURL = "https://github.com/php/frankenphp/releases/download"
+
+	// DefaultVersion is the FrankenPHP release installed when none is found
+	DefaultVersion = "1.9.1"
 )
 
-// EnsureInstalled checks whether the frankenphp binary is available in PATH.
-// If missing (on macOS/Linux), it attempts to download and install it using the
-// official install script. On Windows, users must install via WSL manually.
-func EnsureInstalled() error {
-	if _, err := exec.LookPath("frankenphp"); err == nil {
-		return nil
+// ErrChecksumMismatch is returned when a download does not match its pinned SHA-256
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrNotPinned is returned for a release asset without a pinned SHA-256
+var ErrNotPinned = errors.New("no pinned checksum")
+
+// checksumsFile pins the SHA-256 of the release binaries, one
+// "<sha256>  <version>/<asset>" line each (the format of sha256sum)
+//
+//go:embed checksums.txt
+var checksumsFile string
+
+// Installer downloads a FrankenPHP release binary and verifies it against a
+// pinned SHA-256 before placing it
+type Installer struct {
+	BaseURL   string
+	Version   string
+	Checksums map[string]string // "<version>/<asset>" -> hex SHA-256
+	Dir       string            // directory the binary is placed in; see Store
+	Client    *http.Client
+
+	log *slog.Logger
+}
+
+// NewInstaller returns an installer for DefaultVersion with the pinned
+// checksums; a nil logger uses slog.Default()
+func NewInstaller(logger *slog.Logger) *Installer {
+	return &Installer{
+		BaseURL:   DefaultBaseURL,
+		Version:   DefaultVersion,
+		Checksums: PinnedChecksums(),
+		Client:    &http.Client{Timeout: 10 * time.Minute},
+		log:       logging.OrDefault(logger),
+	}
+}
+
+// PinnedChecksums returns the checksums shipped with Miner
+func PinnedChecksums() map[string]string {
+	sums, _ := ParseChecksums(checksumsFile)
+	return sums
+}
+
+// ParseChecksums reads sha256sum formatted lines ("<sha256>  <name>") into a
+// map from name to checksum. Blank lines and # comments are skipped.
+func ParseChecksums(data string) (map[string]string, error) {
+	sums := map[string]string{}
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid checksum on line %d", n+1)
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid checksum on line %d", n+1)
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
 	}
-	if runtime.GOOS == "windows" {
-		return errors.New("FrankenPHP auto-install unsupported on Windows; use WSL: curl https://frankenphp.dev/install.sh | sh")
+	return sums, nil
+}
+
+// Asset returns the name of the release binary for goos/goarch
+func Asset(goos, goarch string) (string, error) {
+	var platform, arch string
+	switch goos {
+	case "linux":
+		platform = "linux"
+	case "darwin":
+		platform = "mac"
+	default:
+		return "", fmt.Errorf("no FrankenPHP release binary for %s", goos)
 	}
-	if runtime.GOOS != "darwin" && runtime.GOOS != "linux" {
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = map[string]string{"linux": "aarch64", "mac": "arm64"}[platform]
+	default:
+		return "", fmt.Errorf("no FrankenPHP release binary for %s/%s", goos, goarch)
 	}
-	fmt.Println("FrankenPHP not found. Attempting automatic install...")
-	tmpDir, scriptPath, err := downloadScript()
+	return "frankenphp-" + platform + "-" + arch, nil
+}
+
+// Pin trusts sum as the SHA-256 of the release binary of version for this
+// platform, for releases without a pinned checksum
+func (i *Installer) Pin(version, sum string) error {
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
 	if err != nil {
 		return err
 	}
-	if err = runScript(tmpDir, scriptPath); err != nil {
-		return err
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 %q", sum)
 	}
-	if err = placeBinary(tmpDir); err != nil {
-		return err
+	if i.Checksums == nil {
+		i.Checksums = map[string]string{}
 	}
-	fmt.Println("FrankenPHP installed successfully.")
+	i.Checksums[normalize(version)+"/"+asset] = strings.ToLower(sum)
 	return nil
 }
 
-func downloadScript() (string, string, error) {
-	resp, err := http.Get("https://frankenphp.dev/install.sh")
+// URL returns where the release binary asset is downloaded from. BaseURL may
+// also be a local mirror directory (or file:// URL) with the same layout.
+func (i *Installer) URL(asset string) string {
+	return strings.TrimRight(i.BaseURL, "/") + "/v" + normalize(i.Version) + "/" + asset
+}
+
+// Install downloads the release binary for this platform, verifies it and
+// places it in Dir as frankenphp. Nothing is placed unless the download
+// matches its pinned checksum. It returns the path of the binary.
+func (i *Installer) Install() (string, error) {
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
 	if err != nil {
-		return "", "", fmt.Errorf("download failed: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("unexpected status: %s", resp.Status)
+	return i.install(i.URL(asset), asset)
+}
+
+// InstallFile places the release binary of Version at path, such as a copy
+// carried to an offline machine, with the same checks as Install
+func (i *Installer) InstallFile(path string) (string, error) {
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	return i.install(path, asset)
+}
+
+func (i *Installer) install(src, asset string) (string, error) {
+	key := normalize(i.Version) + "/" + asset
+	want, ok := i.Checksums[key]
+	if !ok {
+		return "", fmt.Errorf("%w for FrankenPHP %s", ErrNotPinned, key)
 	}
-	tmpDir, err := os.MkdirTemp("", "frankenphp-install-*")
+
+	// Dir is Miner's own (see Store); a binary a user installed is never there
+	target := filepath.Join(i.Dir, "frankenphp")
+	if isFile(target) {
+		if got, err := FileSHA256(target); err == nil && got == want {
+			i.log.Debug("FrankenPHP binary already in place", "path", target)
+			return target, nil
+		}
+	}
+
+	tmp, err := i.fetch(src, want)
 	if err != nil {
-		return "", "", fmt.Errorf("temp dir error: %w", err)
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	if err := placeBinary(tmp, target); err != nil {
+		return "", err
 	}
-	scriptPath := filepath.Join(tmpDir, "install.sh")
-	f, err := os.Create(scriptPath)
+	return target, nil
+}
+
+// Identify returns the version whose pinned checksum for this platform
+// matches the binary at path
+func (i *Installer) Identify(path string) (string, error) {
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
 	if err != nil {
-		return "", "", fmt.Errorf("script create error: %w", err)
+		return "", err
 	}
-	if _, err = io.Copy(f, resp.Body); err != nil {
-		f.Close()
-		return "", "", fmt.Errorf("write script error: %w", err)
+	sum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
 	}
-	f.Close()
-	if err = os.Chmod(scriptPath, 0o755); err != nil {
-		return "", "", fmt.Errorf("chmod script error: %w", err)
+	for key, want := range i.Checksums {
+		if version, name, _ := strings.Cut(key, "/"); name == asset && want == sum {
+			return version, nil
+		}
 	}
-	return tmpDir, scriptPath, nil
+	return "", fmt.Errorf("%w matches %s (SHA-256 %s)", ErrNotPinned, path, sum)
 }
 
-func runScript(tmpDir, scriptPath string) error {
-	cmd := exec.Command("/bin/sh", scriptPath)
-	cmd.Dir = tmpDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("install script failed: %w", err)
+// FileSHA256 returns the hex SHA-256 of the file at path
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func placeBinary(tmpDir string) error {
-	localBinary := filepath.Join(tmpDir, "frankenphp")
-	if _, err := os.Stat(localBinary); err != nil {
-		return fmt.Errorf("binary missing after install: %w", err)
+// open returns the content of src: an http(s) URL, a file:// URL or a path
+func (i *Installer) open(src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(strings.TrimPrefix(src, "file://"))
+	}
+	resp, err := i.Client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status: %s", src, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetch copies src into a temporary file and checks its SHA-256
+func (i *Installer) fetch(src, want string) (string, error) {
+	i.log.Debug("fetching FrankenPHP", "src", src)
+	r, err := i.open(src)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "frankenphp-download-*")
+	if err != nil {
+		return "", fmt.Errorf("temp file error: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("download failed: %w", err)
 	}
-	targetDir := "/usr/local/bin"
-	if _, err := os.Stat(targetDir); err != nil {
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(want) {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, src, got, want)
+	}
+	i.log.Debug("verified FrankenPHP binary", "sha256", want)
+	return f.Name(), nil
+}
+
+// placeBinary moves the verified binary at src to target atomically: it is
+// completed under a temporary name in the target directory and then renamed,
+// so target is always either the previous file or the whole new binary
+func placeBinary(src, target string) error {
+	dir := filepath.Dir(target)
+	if _, err := os.Stat(dir); err != nil {
 		return fmt.Errorf("target dir missing: %w", err)
 	}
-	targetPath := filepath.Join(targetDir, "frankenphp")
-	if _, err := os.Stat(targetPath); err == nil {
-		_ = os.Remove(targetPath)
+	f, err := os.CreateTemp(dir, ".frankenphp-*")
+	if err != nil {
+		return fmt.Errorf("create target error: %w", err)
 	}
-	if err := os.Rename(localBinary, targetPath); err != nil {
-		in, ierr := os.Open(localBinary)
-		if ierr != nil {
-			return fmt.Errorf("open binary error: %w", ierr)
-		}
-		defer in.Close()
-		out, oerr := os.Create(targetPath)
-		if oerr != nil {
-			return fmt.Errorf("create target error: %w", oerr)
-		}
-		if _, cerr := io.Copy(out, in); cerr != nil {
-			out.Close()
-			return fmt.Errorf("copy binary error: %w", cerr)
+	tmp := f.Name()
+	f.Close()
+	defer os.Remove(tmp) // left behind only on failure
+
+	// A rename only works within a file system; otherwise copy
+	if err := os.Rename(src, tmp); err != nil {
+		if err := copyFile(src, tmp); err != nil {
+			return fmt.Errorf("copy binary error: %w", err)
 		}
-		out.Close()
 	}
-	if err := os.Chmod(targetPath, 0o755); err != nil {
+	if err := os.Chmod(tmp, 0o755); err != nil {
 		return fmt.Errorf("chmod target error: %w", err)
 	}
-	if _, err := exec.LookPath("frankenphp"); err != nil {
-		return fmt.Errorf("frankenphp not in PATH after install: %w", err)
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("place binary error: %w", err)
 	}
 	return nil
 }
+
+// copyFile copies src over dst and syncs it to disk, keeping the mode of src
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
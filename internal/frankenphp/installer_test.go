@@ -0,0 +1,186 @@
+package frankenphp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeRelease serves binary as the asset of version for this platform
+func fakeRelease(t *testing.T, version string, binary []byte) (*httptest.Server, string) {
+	t.Helper()
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		t.Skip(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v"+version+"/"+asset, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, asset
+}
+
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func testInstaller(t *testing.T, baseURL string, checksums map[string]string) *Installer {
+	i := NewInstaller(nil)
+	i.BaseURL = baseURL
+	i.Version = "1.2.3"
+	i.Checksums = checksums
+	i.Dir = t.TempDir()
+	return i
+}
+
+func TestInstall(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho FrankenPHP v1.2.3\n")
+	srv, asset := fakeRelease(t, "1.2.3", binary)
+	i := testInstaller(t, srv.URL, map[string]string{"1.2.3/" + asset: sum(binary)})
+
+	path, err := i.Install()
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if want := filepath.Join(i.Dir, "frankenphp"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != string(binary) {
+		t.Fatalf("installed binary = %q, %v", data, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o755 {
+		t.Errorf("mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestInstallRefusesMismatch(t *testing.T) {
+	srv, asset := fakeRelease(t, "1.2.3", []byte("tampered"))
+	i := testInstaller(t, srv.URL, map[string]string{"1.2.3/" + asset: sum([]byte("genuine"))})
+
+	if _, err := i.Install(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Install error = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if _, err := os.Stat(filepath.Join(i.Dir, "frankenphp")); !os.IsNotExist(err) {
+		t.Errorf("binary placed despite the mismatch: %v", err)
+	}
+}
+
+func TestInstallOverExistingBinary(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho FrankenPHP v1.2.3\n")
+	srv, asset := fakeRelease(t, "1.2.3", binary)
+	i := testInstaller(t, srv.URL, map[string]string{"1.2.3/" + asset: sum(binary)})
+	existing := filepath.Join(i.Dir, "frankenphp")
+	if err := os.WriteFile(existing, []byte("partial"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something else in Miner's own dir is replaced by the verified release
+	if path, err := i.Install(); err != nil || path != existing {
+		t.Fatalf("Install = %s, %v", path, err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != string(binary) {
+		t.Errorf("binary = %q, want the release", data)
+	}
+
+	// The same release already in place is not downloaded again
+	i.BaseURL = "http://127.0.0.1:0"
+	if path, err := i.Install(); err != nil || path != existing {
+		t.Errorf("Install over the same release = %s, %v", path, err)
+	}
+}
+
+func TestPlaceBinaryFailureKeepsTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "frankenphp")
+	if err := os.WriteFile(target, []byte("previous"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeBinary(filepath.Join(dir, "missing"), target); err == nil {
+		t.Fatal("placeBinary succeeded without a source")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "previous" {
+		t.Errorf("target = %q after a failed placement", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("failed placement left %d files behind", len(entries)-1)
+	}
+}
+
+func TestInstallRefusesUnpinned(t *testing.T) {
+	srv, _ := fakeRelease(t, "1.2.3", []byte("binary"))
+	i := testInstaller(t, srv.URL, map[string]string{})
+
+	if _, err := i.Install(); !errors.Is(err, ErrNotPinned) {
+		t.Fatalf("Install error = %v, want %v", err, ErrNotPinned)
+	}
+}
+
+func TestInstallMissingRelease(t *testing.T) {
+	srv, asset := fakeRelease(t, "1.2.3", []byte("binary"))
+	i := testInstaller(t, srv.URL, map[string]string{"9.9.9/" + asset: sum([]byte("binary"))})
+	i.Version = "9.9.9"
+
+	if _, err := i.Install(); err == nil {
+		t.Fatal("Install succeeded for a release the server does not have")
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	a := sum([]byte("a"))
+	sums, err := ParseChecksums("# comment\n\n" + a + "  1.0.0/frankenphp-linux-x86_64\n" + a + " *1.0.0/frankenphp-mac-arm64\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 || sums["1.0.0/frankenphp-linux-x86_64"] != a || sums["1.0.0/frankenphp-mac-arm64"] != a {
+		t.Errorf("ParseChecksums = %v", sums)
+	}
+	if _, err := ParseChecksums("abc  1.0.0/frankenphp-linux-x86_64\n"); err == nil {
+		t.Error("ParseChecksums accepted a short checksum")
+	}
+	if _, err := ParseChecksums(checksumsFile); err != nil {
+		t.Errorf("shipped checksums.txt: %v", err)
+	}
+}
+
+// The shipped checksums must cover DefaultVersion on every platform with a
+// release binary, or Miner cannot install FrankenPHP there
+func TestPinnedDefaultVersion(t *testing.T) {
+	pinned := PinnedChecksums()
+	for _, goos := range []string{"linux", "darwin"} {
+		for _, goarch := range []string{"amd64", "arm64"} {
+			asset, err := Asset(goos, goarch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := pinned[DefaultVersion+"/"+asset]; !ok {
+				t.Errorf("checksums.txt has no entry for %s/%s; run 'make checksums'", DefaultVersion, asset)
+			}
+		}
+	}
+}
+
+func TestAsset(t *testing.T) {
+	for _, tt := range []struct{ goos, goarch, want string }{
+		{"linux", "amd64", "frankenphp-linux-x86_64"},
+		{"linux", "arm64", "frankenphp-linux-aarch64"},
+		{"darwin", "amd64", "frankenphp-mac-x86_64"},
+		{"darwin", "arm64", "frankenphp-mac-arm64"},
+		{"windows", "amd64", ""},
+		{"linux", "386", ""},
+	} {
+		got, err := Asset(tt.goos, tt.goarch)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("Asset(%s, %s) = %q, %v", tt.goos, tt.goarch, got, err)
+		}
+	}
+}
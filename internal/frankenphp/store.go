@@ -0,0 +1,417 @@
+package frankenphp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/bundle"
+	"github.com/4nkitd/miner/internal/logging"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// Layout of a store directory:
+//
+//	versions/<version>/frankenphp  installed releases
+//	current -> versions/<version>  the version in use
+//	previous                       the version used before, for Rollback
+const (
+	versionsDir  = "versions"
+	currentLink  = "current"
+	previousFile = "previous"
+)
+
+// ErrNoVersion is returned when the store has no current version
+var ErrNoVersion = errors.New("no FrankenPHP version in use")
+
+// Store manages side-by-side FrankenPHP versions in a directory
+type Store struct {
+	dir       string
+	installer *Installer
+	choose    func(Existing) bool
+	runner    runner.Runner
+	log       *slog.Logger
+}
+
+// Existing is a FrankenPHP binary found in PATH, which Miner never modifies
+type Existing struct {
+	Path    string
+	Version string // "" when it does not report one
+}
+
+// NewStore creates a store in dir that downloads with NewInstaller; a nil
+// logger uses slog.Default()
+func NewStore(dir string, logger *slog.Logger) *Store {
+	logger = logging.OrDefault(logger)
+	return &Store{dir: dir, installer: NewInstaller(logger), runner: runner.Exec{}, log: logger}
+}
+
+// SetRunner changes how frankenphp binaries are looked up and run; tests pass
+// a runner.Fake
+func (s *Store) SetRunner(r runner.Runner) {
+	s.runner = r
+}
+
+// SetInstaller changes where and how releases are downloaded
+func (s *Store) SetInstaller(i *Installer) {
+	s.installer = i
+}
+
+// SetChooser makes EnsureInstalled ask choose, when it finds a usable
+// FrankenPHP in PATH, whether to install Miner's copy beside it and use that
+// instead. Without a chooser the binary in PATH is used.
+func (s *Store) SetChooser(choose func(Existing) bool) {
+	s.choose = choose
+}
+
+// Dir returns the store directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Binary returns the path of the binary of version
+func (s *Store) Binary(version string) string {
+	return filepath.Join(s.dir, versionsDir, normalize(version), "frankenphp")
+}
+
+// CurrentBinary returns the stable path of the binary in use; it follows Use
+func (s *Store) CurrentBinary() string {
+	return filepath.Join(s.dir, currentLink, "frankenphp")
+}
+
+// Versions returns the installed versions, oldest first
+func (s *Store) Versions() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, versionsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, e := range entries {
+		if _, err := os.Stat(s.Binary(e.Name())); e.IsDir() && err == nil {
+			versions = append(versions, e.Name())
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+// Current returns the version in use
+func (s *Store) Current() (string, error) {
+	target, err := os.Readlink(filepath.Join(s.dir, currentLink))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNoVersion
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// Previous returns the version Rollback switches back to, or ""
+func (s *Store) Previous() string {
+	data, err := os.ReadFile(filepath.Join(s.dir, previousFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Install downloads and verifies version into the store. An installed
+// version is left as is. It returns the path of the binary.
+func (s *Store) Install(version string) (string, error) {
+	return s.install(version, (*Installer).Install)
+}
+
+// install places version into the store with place, given a copy of the
+// store's installer set up for version
+func (s *Store) install(version string, place func(*Installer) (string, error)) (string, error) {
+	version = normalize(version)
+	if path := s.Binary(version); isFile(path) {
+		s.log.Debug("FrankenPHP version already installed", "version", version, "path", path)
+		return path, nil
+	}
+	dir := filepath.Dir(s.Binary(version))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	i := *s.installer
+	i.Version, i.Dir = version, dir
+	path, err := place(&i)
+	if err != nil {
+		os.Remove(dir) // only if the failed install left it empty
+		return "", err
+	}
+	s.log.Info("FrankenPHP installed", "version", version, "path", path)
+	return path, nil
+}
+
+// InstallFrom installs and puts in use a FrankenPHP release without network
+// access. src is a release binary, a mirror directory laid out as
+// <src>/v<version>/<asset>, or a tarball holding either, such as one made by
+// `miner bundle create`. The binary must match its pinned checksum, or sum
+// when that is set. It returns the version installed.
+func (s *Store) InstallFrom(src, sum string, rec manifest.Recorder) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	root := src
+	if !info.IsDir() && bundle.IsTarball(src) {
+		tmp, err := os.MkdirTemp("", "frankenphp-bundle-*")
+		if err != nil {
+			return "", fmt.Errorf("temp dir error: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		if err := bundle.Extract(src, tmp); err != nil {
+			return "", err
+		}
+		root, info = tmp, nil
+	}
+
+	file, hint := src, ""
+	if root != src || info.IsDir() {
+		if file, hint, err = s.find(root); err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+	}
+
+	version := hint
+	if sum == "" {
+		// Identify by the pinned checksums rather than trusting a name
+		if version, err = s.installer.Identify(file); err != nil {
+			return "", err
+		}
+	} else {
+		got, err := FileSHA256(file)
+		if err != nil {
+			return "", err
+		}
+		if got != strings.ToLower(sum) {
+			return "", fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, file, got, sum)
+		}
+		if version == "" {
+			if version, err = Version(s.runner, file); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	path, err := s.install(version, func(i *Installer) (string, error) {
+		if sum != "" {
+			i.Checksums = maps.Clone(i.Checksums)
+			if err := i.Pin(i.Version, sum); err != nil {
+				return "", err
+			}
+		}
+		return i.InstallFile(file)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.Use(version); err != nil {
+		return "", err
+	}
+	s.record(rec, path)
+	return normalize(version), nil
+}
+
+// find returns the release binary for this platform under dir and the
+// version named by its parent directory (e.g. v1.9.1), preferring the
+// installer's version, else the newest
+func (s *Store) find(dir string) (path, version string, err error) {
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", "", err
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || (d.Name() != asset && d.Name() != "frankenphp") {
+			return err
+		}
+		v := normalize(filepath.Base(filepath.Dir(p)))
+		if v == "" || v[0] < '0' || v[0] > '9' {
+			v = ""
+		}
+		if path == "" || v == normalize(s.installer.Version) ||
+			(version != normalize(s.installer.Version) && CompareVersions(v, version) > 0) {
+			path, version = p, v
+		}
+		return nil
+	})
+	if err == nil && path == "" {
+		err = fmt.Errorf("no FrankenPHP binary named %s or frankenphp found", asset)
+	}
+	return path, version, err
+}
+
+// Use switches the current version to an installed version. The switch is
+// atomic: the current link is replaced by renaming a new link over it.
+func (s *Store) Use(version string) error {
+	version = normalize(version)
+	if !isFile(s.Binary(version)) {
+		return fmt.Errorf("FrankenPHP %s is not installed; run 'miner frankenphp install %s'", version, version)
+	}
+	current, err := s.Current()
+	if err != nil && !errors.Is(err, ErrNoVersion) {
+		return err
+	}
+	if current == version {
+		return nil
+	}
+
+	link := filepath.Join(s.dir, currentLink)
+	tmp := fmt.Sprintf("%s.tmp-%d", link, os.Getpid())
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Join(versionsDir, version), tmp); err != nil {
+		return fmt.Errorf("failed to link FrankenPHP %s: %w", version, err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to switch to FrankenPHP %s: %w", version, err)
+	}
+	if current != "" {
+		if err := os.WriteFile(filepath.Join(s.dir, previousFile), []byte(current+"\n"), 0o644); err != nil {
+			s.log.Warn("failed to remember the previous FrankenPHP version", "err", err)
+		}
+	}
+	s.log.Debug("switched FrankenPHP version", "from", current, "to", version)
+	return nil
+}
+
+// Rollback switches back to the version used before the last Use. It
+// returns the version now in use.
+func (s *Store) Rollback() (string, error) {
+	previous := s.Previous()
+	if previous == "" {
+		return "", errors.New("no previous FrankenPHP version to roll back to")
+	}
+	return previous, s.Use(previous)
+}
+
+// EnsureInstalled makes a FrankenPHP binary available: the current version of
+// the store, else one in PATH that is not older than MinVersion (unless the
+// chooser prefers Miner's copy), else DefaultVersion downloaded into the store
+// and put in use. A binary in PATH is never modified: the store's copy takes
+// precedence over it, and it is used again once uninstall removes the store.
+// The files it creates are recorded to rec unless it is nil.
+// On Windows, users must install via WSL manually.
+func (s *Store) EnsureInstalled(rec manifest.Recorder) error {
+	if isFile(s.CurrentBinary()) {
+		s.log.Debug("FrankenPHP found", "path", s.CurrentBinary())
+		return nil
+	}
+	if path, err := Lookup(s.runner); err == nil {
+		version, err := CheckVersion(s.runner, path)
+		switch {
+		case err != nil && version != "":
+			// One that does not report its version is given the benefit of the doubt
+			s.log.Warn("FrankenPHP in PATH is too old; installing Miner's own copy beside it", "path", path, "version", version)
+		case s.choose != nil && s.choose(Existing{Path: path, Version: version}):
+			s.log.Info("installing Miner's own FrankenPHP beside the one in PATH", "path", path, "version", version)
+		default:
+			s.log.Debug("FrankenPHP found", "path", path, "version", version)
+			return nil
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("FrankenPHP auto-install unsupported on Windows; use WSL: curl https://frankenphp.dev/install.sh | sh")
+	}
+	if runtime.GOOS != "darwin" && runtime.GOOS != "linux" {
+		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+
+	version := normalize(s.installer.Version)
+	s.log.Info("installing FrankenPHP", "version", version)
+	path, err := s.Install(version)
+	if err != nil {
+		return err
+	}
+	if err := s.Use(version); err != nil {
+		return err
+	}
+	s.record(rec, path)
+	return nil
+}
+
+// record records the files of the store, and the store itself, for the
+// binary at path. A nil rec records nothing.
+func (s *Store) record(rec manifest.Recorder, path string) {
+	if rec == nil {
+		return
+	}
+	// Directories first, so that uninstall removes them last (if empty)
+	for _, dir := range []string{s.dir, filepath.Join(s.dir, versionsDir), filepath.Dir(path)} {
+		rec.Record(manifest.Change{Component: manifest.ComponentFrankenPHP, Kind: manifest.KindDir, Path: dir})
+	}
+	for _, file := range []string{path, filepath.Join(s.dir, currentLink), filepath.Join(s.dir, previousFile)} {
+		rec.Record(manifest.Change{Component: manifest.ComponentFrankenPHP, Kind: manifest.KindFile, Path: file})
+	}
+}
+
+// Resolve returns the FrankenPHP binary to run: the current version of the
+// first store that has one, else frankenphp from PATH as found by r
+func Resolve(r runner.Runner, storeDirs ...string) (string, error) {
+	for _, dir := range storeDirs {
+		if path := NewStore(dir, nil).CurrentBinary(); isFile(path) {
+			return path, nil
+		}
+	}
+	return Lookup(r)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// normalize strips the "v" prefix of release tags
+func normalize(version string) string {
+	return strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
+
+// CompareVersions compares dotted versions such as "1.9.1" numerically and
+// returns -1, 0 or 1. A pre-release suffix ("1.10.0-rc1") sorts before the
+// release.
+func CompareVersions(a, b string) int {
+	a, preA, _ := strings.Cut(normalize(a), "-")
+	b, preB, _ := strings.Cut(normalize(b), "-")
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	case preA < preB:
+		return -1
+	default:
+		return 1
+	}
+}
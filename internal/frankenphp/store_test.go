@@ -0,0 +1,281 @@
+package frankenphp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/4nkitd/miner/internal/bundle"
+	"github.com/4nkitd/miner/internal/manifest"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// testStore returns a store in a temp dir downloading from a fake release
+// server that has the given versions
+func testStore(t *testing.T, versions ...string) *Store {
+	t.Helper()
+	asset, err := Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		t.Skip(err)
+	}
+	mux := http.NewServeMux()
+	checksums := map[string]string{}
+	for _, v := range versions {
+		binary := []byte("#!/bin/sh\necho FrankenPHP v" + v + "\n")
+		mux.HandleFunc("/v"+v+"/"+asset, func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+		checksums[v+"/"+asset] = sum(binary)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	s := NewStore(t.TempDir(), nil)
+	i := NewInstaller(nil)
+	i.BaseURL, i.Checksums = srv.URL, checksums
+	s.SetInstaller(i)
+	return s
+}
+
+func TestStoreUseAndRollback(t *testing.T) {
+	s := testStore(t, "1.8.0", "1.9.1", "1.10.0")
+	for _, v := range []string{"1.10.0", "v1.8.0", "1.9.1"} {
+		if _, err := s.Install(v); err != nil {
+			t.Fatalf("Install(%s): %v", v, err)
+		}
+	}
+	if got, _ := s.Versions(); !reflect.DeepEqual(got, []string{"1.8.0", "1.9.1", "1.10.0"}) {
+		t.Errorf("Versions = %v", got)
+	}
+	if _, err := s.Current(); !errors.Is(err, ErrNoVersion) {
+		t.Errorf("Current before Use = %v, want %v", err, ErrNoVersion)
+	}
+	if _, err := s.Rollback(); err == nil {
+		t.Error("Rollback succeeded without a previous version")
+	}
+
+	if err := s.Use("1.9.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Use("1.10.0"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.CurrentBinary())
+	if err != nil || string(data) != "#!/bin/sh\necho FrankenPHP v1.10.0\n" {
+		t.Fatalf("current binary = %q, %v", data, err)
+	}
+
+	if v, err := s.Rollback(); err != nil || v != "1.9.1" {
+		t.Fatalf("Rollback = %s, %v", v, err)
+	}
+	if v, _ := s.Current(); v != "1.9.1" {
+		t.Errorf("Current after rollback = %s", v)
+	}
+	// A second rollback undoes the first
+	if v, err := s.Rollback(); err != nil || v != "1.10.0" {
+		t.Fatalf("second Rollback = %s, %v", v, err)
+	}
+
+	if err := s.Use("2.0.0"); err == nil {
+		t.Error("Use of a version that is not installed succeeded")
+	}
+}
+
+func TestStoreInstallFailureLeavesNoVersion(t *testing.T) {
+	s := testStore(t, "1.9.1")
+	if _, err := s.Install("1.2.3"); err == nil {
+		t.Fatal("Install of an unpinned version succeeded")
+	}
+	if _, err := os.Stat(filepath.Dir(s.Binary("1.2.3"))); !os.IsNotExist(err) {
+		t.Errorf("failed install left its directory behind: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s := testStore(t, "1.9.1")
+	empty := t.TempDir()
+	if _, err := s.Install("1.9.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Use("1.9.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Resolve(runner.NewFake(), empty, s.Dir()); err != nil || got != s.CurrentBinary() {
+		t.Errorf("Resolve = %s, %v; want %s", got, err, s.CurrentBinary())
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.9.1", "1.9.1", 0},
+		{"v1.9.1", "1.9.1", 0},
+		{"1.9.1", "1.10.0", -1},
+		{"2.0", "1.99.99", 1},
+		{"1.0", "1.0.0", 0},
+		{"1.10.0-rc1", "1.10.0", -1},
+		{"1.10.0-rc2", "1.10.0-rc1", 1},
+	} {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// writeMirror lays out the binaries of versions as <dir>/v<version>/<asset>,
+// the way testStore serves them
+func writeMirror(t *testing.T, dir string, versions ...string) {
+	t.Helper()
+	asset, _ := Asset(runtime.GOOS, runtime.GOARCH)
+	for _, v := range versions {
+		if err := os.MkdirAll(filepath.Join(dir, "v"+v), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		binary := []byte("#!/bin/sh\necho FrankenPHP v" + v + "\n")
+		if err := os.WriteFile(filepath.Join(dir, "v"+v, asset), binary, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoreInstallFrom(t *testing.T) {
+	mirror := t.TempDir()
+	writeMirror(t, mirror, "1.9.1", "1.10.0")
+	tarball := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	entries, err := bundle.Dir(mirror, "miner-1.0.0/frankenphp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.Write(f, entries); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	asset, _ := Asset(runtime.GOOS, runtime.GOARCH)
+
+	for _, tc := range []struct {
+		name, src, want string
+	}{
+		{"mirror prefers the default version", mirror, "1.9.1"},
+		{"tarball", tarball, "1.9.1"},
+		{"binary identified by its checksum", filepath.Join(mirror, "v1.10.0", asset), "1.10.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testStore(t, "1.9.1", "1.10.0")
+			m := &manifest.Manifest{}
+			v, err := s.InstallFrom(tc.src, "", m)
+			if err != nil || v != tc.want {
+				t.Fatalf("InstallFrom = %s, %v; want %s", v, err, tc.want)
+			}
+			if current, _ := s.Current(); current != tc.want {
+				t.Errorf("Current = %s, want %s", current, tc.want)
+			}
+			if len(m.Changes) == 0 {
+				t.Error("InstallFrom recorded no changes")
+			}
+		})
+	}
+}
+
+func TestStoreInstallFromUnpinned(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs a shell script")
+	}
+	mirror := t.TempDir()
+	writeMirror(t, mirror, "2.0.0")
+	asset, _ := Asset(runtime.GOOS, runtime.GOARCH)
+	binary := filepath.Join(mirror, "v2.0.0", asset)
+	data, _ := os.ReadFile(binary)
+
+	s := testStore(t, "1.9.1")
+	if _, err := s.InstallFrom(binary, "", nil); !errors.Is(err, ErrNotPinned) {
+		t.Fatalf("InstallFrom of an unpinned binary = %v, want %v", err, ErrNotPinned)
+	}
+	if _, err := s.InstallFrom(binary, sum([]byte("other")), nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("InstallFrom with a wrong SHA-256 = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if versions, _ := s.Versions(); len(versions) != 0 {
+		t.Fatalf("refused installs left versions %v", versions)
+	}
+
+	// Copied out of the mirror, the version comes from the binary itself
+	copied := filepath.Join(t.TempDir(), "frankenphp")
+	if err := os.WriteFile(copied, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.InstallFrom(copied, sum(data), nil); err != nil || v != "2.0.0" {
+		t.Fatalf("InstallFrom with its SHA-256 = %s, %v", v, err)
+	}
+}
+
+func TestStoreInstallFromMirrorBaseURL(t *testing.T) {
+	mirror := t.TempDir()
+	writeMirror(t, mirror, "1.9.1")
+	s := testStore(t, "1.9.1")
+	s.installer.BaseURL = "file://" + mirror
+	if _, err := s.Install("1.9.1"); err != nil {
+		t.Fatalf("Install from a mirror directory: %v", err)
+	}
+}
+
+func TestEnsureInstalledBesideOldPathBinary(t *testing.T) {
+	fake := runner.NewFake()
+	fake.Handle("/usr/local/bin/frankenphp", runner.Exit(0, "FrankenPHP v0.9.0 PHP 8.2.0\n", ""))
+
+	s := testStore(t, DefaultVersion)
+	s.SetRunner(fake)
+	if err := s.EnsureInstalled(nil); err != nil {
+		t.Fatalf("EnsureInstalled: %v", err)
+	}
+	if v, _ := s.Current(); v != DefaultVersion {
+		t.Errorf("Current = %q, want %s installed beside the old binary", v, DefaultVersion)
+	}
+
+	// A usable binary in PATH is used as is
+	fake.Handle("/usr/local/bin/frankenphp", runner.Exit(0, "FrankenPHP v1.9.1 PHP 8.4.12\n", ""))
+	s = testStore(t)
+	s.SetRunner(fake)
+	if err := s.EnsureInstalled(nil); err != nil {
+		t.Fatalf("EnsureInstalled with a usable binary in PATH: %v", err)
+	}
+	if versions, _ := s.Versions(); len(versions) != 0 {
+		t.Errorf("installed %v despite a usable binary in PATH", versions)
+	}
+}
+
+func TestEnsureInstalledChooser(t *testing.T) {
+	fake := runner.NewFake()
+	fake.Handle("/usr/local/bin/frankenphp", runner.Exit(0, "FrankenPHP v1.4.0 PHP 8.3.0\n", ""))
+
+	for _, choice := range []bool{false, true} {
+		var asked []Existing
+		s := testStore(t, DefaultVersion)
+		s.SetRunner(fake)
+		s.SetChooser(func(e Existing) bool {
+			asked = append(asked, e)
+			return choice
+		})
+		m := &manifest.Manifest{}
+		if err := s.EnsureInstalled(m); err != nil {
+			t.Fatalf("EnsureInstalled: %v", err)
+		}
+		if want := []Existing{{Path: "/usr/local/bin/frankenphp", Version: "1.4.0"}}; !reflect.DeepEqual(asked, want) {
+			t.Errorf("asked about %+v, want %+v", asked, want)
+		}
+		current, _ := s.Current()
+		switch {
+		case choice && (current != DefaultVersion || len(m.Changes) == 0):
+			t.Errorf("chose Miner's copy: Current = %q, recorded %d changes", current, len(m.Changes))
+		case !choice && (current != "" || len(m.Changes) != 0):
+			t.Errorf("kept the binary in PATH: Current = %q, recorded %v", current, m.Changes)
+		}
+	}
+}
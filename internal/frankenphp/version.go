@@ -0,0 +1,46 @@
+package frankenphp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// MinVersion is the oldest FrankenPHP release the generated Caddyfile works with
+const MinVersion = "1.0.0"
+
+// versionPattern extracts the version from `frankenphp version` output, e.g.
+// "FrankenPHP v1.9.1 PHP 8.4.12 Caddy v2.10.2 h1:..."
+var versionPattern = regexp.MustCompile(`FrankenPHP v?(\d+\.\d+\.\d+\S*)`)
+
+// Lookup returns the path of the frankenphp binary found in PATH by r
+func Lookup(r runner.Runner) (string, error) {
+	return r.LookPath("frankenphp")
+}
+
+// Version runs `<path> version` with r and returns the FrankenPHP version
+func Version(r runner.Runner, path string) (string, error) {
+	out, err := runner.Output(r, &runner.Cmd{Path: path, Args: []string{"version"}})
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s version: %w", path, err)
+	}
+	if m := versionPattern.FindStringSubmatch(string(out)); m != nil {
+		return m[1], nil
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return "", fmt.Errorf("unrecognized version output: %q", first)
+}
+
+// CheckVersion returns an error if the binary at path is older than MinVersion
+func CheckVersion(r runner.Runner, path string) (string, error) {
+	version, err := Version(r, path)
+	if err != nil {
+		return "", err
+	}
+	if CompareVersions(version, MinVersion) < 0 {
+		return version, fmt.Errorf("FrankenPHP %s at %s is older than the minimum supported version %s; run 'miner frankenphp install %s'", version, path, MinVersion, DefaultVersion)
+	}
+	return version, nil
+}
@@ -2,80 +2,483 @@ package hosts
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/txn2/txeh"
+	"github.com/4nkitd/miner/internal/logging"
+)
+
+// Markers delimiting the entries Miner manages in the hosts file
+const (
+	blockBegin = "# BEGIN miner"
+	blockEnd   = "# END miner"
+)
+
+// Backups are written next to the hosts file as hosts.miner-<timestamp>.bak
+const (
+	backupPrefix     = ".miner-"
+	backupSuffix     = ".bak"
+	backupTimeLayout = "20060102-150405"
+
+	// MaxBackups is how many backups are kept; older ones are pruned
+	MaxBackups = 10
+)
+
+// Ownership tells who wrote the hosts entry of a domain
+type Ownership string
+
+const (
+	Missing Ownership = "missing" // no entry
+	Managed Ownership = "managed" // inside Miner's block
+	User    Ownership = "user"    // outside the block, written by the user or another tool
 )
 
 // Manager handles hosts file modifications
 type Manager struct {
 	hostsPath string
+	log       *slog.Logger
 }
 
-// NewManager creates a new hosts file manager
-func NewManager(hostsPath string) *Manager {
+// NewManager creates a new hosts file manager; a nil logger uses slog.Default()
+func NewManager(hostsPath string, logger *slog.Logger) *Manager {
 	return &Manager{
 		hostsPath: hostsPath,
+		log:       logging.OrDefault(logger),
 	}
 }
 
-// AddEntry adds a domain to IP mapping in the hosts file
-func (m *Manager) AddEntry(domain, ip string) error {
-	cfg := &txeh.HostsConfig{ReadFilePath: m.hostsPath, WriteFilePath: m.hostsPath}
-	hosts, err := txeh.NewHosts(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to load hosts file: %w", err)
+// ValidateHostname returns an error unless name is a hostname that can be
+// written to the hosts file: dot-separated labels of letters, digits and
+// inner hyphens, each at most 63 characters long
+func ValidateHostname(name string) error {
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid hostname %q", name)
 	}
-	hosts.AddHost(ip, domain)
-	if err := hosts.Save(); err != nil {
-		return fmt.Errorf("failed to save hosts file: %w", err)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname %q", name)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("invalid hostname %q", name)
+			}
+		}
 	}
 	return nil
 }
 
-// RemoveEntry removes a domain from the hosts file
+// AddEntry maps domain to each of ips inside Miner's block of the hosts file,
+// replacing earlier mappings of domain in the block. Entries outside the
+// block are left alone.
+func (m *Manager) AddEntry(domain string, ips ...string) error {
+	if err := ValidateHostname(domain); err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("no address to map %s to", domain)
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %q", ip)
+		}
+	}
+	lines, err := m.read()
+	if err != nil {
+		return err
+	}
+	before, block, after := splitBlock(lines)
+
+	var updated []string
+	for _, line := range block {
+		if !mapsDomain(line, domain) {
+			updated = append(updated, line)
+		}
+	}
+	for _, ip := range ips {
+		updated = append(updated, ip+"\t"+domain)
+	}
+
+	m.log.Debug("adding hosts entry", "domain", domain, "ips", ips, "path", m.hostsPath)
+	return m.write(joinBlock(before, updated, after))
+}
+
+// RemoveEntry removes the mappings of domain from Miner's block, and the block
+// once it is empty. An entry the user wrote outside the block is kept.
 func (m *Manager) RemoveEntry(domain string) error {
-	cfg := &txeh.HostsConfig{ReadFilePath: m.hostsPath, WriteFilePath: m.hostsPath}
-	hosts, err := txeh.NewHosts(cfg)
+	lines, err := m.read()
 	if err != nil {
-		return fmt.Errorf("failed to load hosts file: %w", err)
+		return err
 	}
-	hosts.RemoveHost(domain)
-	if err := hosts.Save(); err != nil {
-		return fmt.Errorf("failed to save hosts file: %w", err)
+	before, block, after := splitBlock(lines)
+
+	var updated []string
+	for _, line := range block {
+		if !mapsDomain(line, domain) {
+			updated = append(updated, line)
+		}
 	}
-	return nil
+	if len(updated) == len(block) {
+		if owner, _ := ownership(lines, domain); owner == User {
+			m.log.Info("keeping hosts entry not written by Miner", "domain", domain, "path", m.hostsPath)
+		}
+		return nil
+	}
+
+	m.log.Debug("removing hosts entry", "domain", domain, "path", m.hostsPath)
+	return m.write(joinBlock(before, updated, after))
 }
 
-// HasEntry checks if a domain exists in the hosts file
-func (m *Manager) HasEntry(domain string) (bool, error) {
-	f, err := os.Open(m.hostsPath)
+// HasEntry checks if a domain exists in the hosts file, whether managed by
+// Miner or not; see Ownership to tell them apart. Given ips, it also checks
+// that the domain resolves to each of them: a stale mapping counts as missing.
+func (m *Manager) HasEntry(domain string, ips ...string) (bool, error) {
+	mappings, err := m.Mappings(domain)
+	if err != nil || len(mappings) == 0 {
+		return false, err
+	}
+	for _, ip := range ips {
+		if got, ok := Resolve(mappings, ip); !ok || !sameIP(got.IP, ip) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Mapping is a line of the hosts file mapping a domain to an address
+type Mapping struct {
+	Domain  string `json:"domain"`
+	IP      string `json:"ip"`
+	Managed bool   `json:"managed"` // inside Miner's block
+}
+
+// Mappings returns every mapping of domain, in file order
+func (m *Manager) Mappings(domain string) ([]Mapping, error) {
+	lines, err := m.read()
 	if err != nil {
-		return false, fmt.Errorf("failed to open hosts file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	var mappings []Mapping
+	for _, part := range parts(lines) {
+		for _, line := range part.lines {
+			if ip, ok := mapping(line, domain); ok {
+				mappings = append(mappings, Mapping{Domain: domain, IP: ip, Managed: part.managed})
+			}
 		}
-		// Split by whitespace
+	}
+	return mappings, nil
+}
+
+// Entries returns the mappings inside Miner's block
+func (m *Manager) Entries() ([]Mapping, error) {
+	lines, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	_, block, _ := splitBlock(lines)
+	var entries []Mapping
+	for _, line := range block {
+		line, _, _ = strings.Cut(line, "#")
 		fields := strings.Fields(line)
 		if len(fields) < 2 {
 			continue
 		}
-		// domains can follow the IP; check any field after the first
-		for _, fld := range fields[1:] {
-			if fld == domain {
-				return true, nil
+		for _, domain := range fields[1:] {
+			entries = append(entries, Mapping{Domain: domain, IP: fields[0], Managed: true})
+		}
+	}
+	return entries, nil
+}
+
+// Resolve returns the mapping used for lookups of the address family of ip:
+// resolvers take the first line of that family
+func Resolve(mappings []Mapping, ip string) (Mapping, bool) {
+	for _, mp := range mappings {
+		if isIPv6(mp.IP) == isIPv6(ip) {
+			return mp, true
+		}
+	}
+	return Mapping{}, false
+}
+
+func isIPv6(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() == nil
+}
+
+func sameIP(a, b string) bool {
+	pa, pb := net.ParseIP(a), net.ParseIP(b)
+	if pa == nil || pb == nil {
+		return a == b
+	}
+	return pa.Equal(pb)
+}
+
+// Ownership reports whether domain is mapped inside Miner's block, only
+// outside of it, or not at all
+func (m *Manager) Ownership(domain string) (Ownership, error) {
+	lines, err := m.read()
+	if err != nil {
+		return Missing, err
+	}
+	owner, _ := ownership(lines, domain)
+	return owner, nil
+}
+
+// Lookup returns the IP the hosts file maps domain to, or "" if it has no entry
+func (m *Manager) Lookup(domain string) (string, error) {
+	lines, err := m.read()
+	if err != nil {
+		return "", err
+	}
+	_, ip := ownership(lines, domain)
+	return ip, nil
+}
+
+// ownership finds the first mapping of domain; the resolver uses the first
+// matching line, wherever it is
+func ownership(lines []string, domain string) (Ownership, string) {
+	for _, part := range parts(lines) {
+		for _, line := range part.lines {
+			if ip, ok := mapping(line, domain); ok {
+				if part.managed {
+					return Managed, ip
+				}
+				return User, ip
 			}
 		}
 	}
+	return Missing, ""
+}
+
+// mapping returns the IP of line if it maps domain
+func mapping(line, domain string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false
+	}
+	// Trailing comments are allowed after the names
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", false
+	}
+	// domains can follow the IP; check any field after the first
+	for _, fld := range fields[1:] {
+		if strings.EqualFold(fld, domain) {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+func mapsDomain(line, domain string) bool {
+	_, ok := mapping(line, domain)
+	return ok
+}
+
+// splitBlock splits the hosts file into the lines before Miner's block, the
+// lines inside it and the lines after it. The block runs from the last BEGIN
+// marker before the first END marker following it; stray markers left by an
+// interrupted edit are dropped, so the lines around them stay the user's.
+func splitBlock(lines []string) (before, block, after []string) {
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case blockBegin:
+			if end < 0 {
+				begin = i
+			}
+		case blockEnd:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	if begin < 0 || end < 0 {
+		return withoutMarkers(lines), nil, nil
+	}
+	return withoutMarkers(lines[:begin]), lines[begin+1 : end], withoutMarkers(lines[end+1:])
+}
+
+// withoutMarkers returns lines without block markers
+func withoutMarkers(lines []string) []string {
+	var out []string
+	for _, line := range lines {
+		switch strings.TrimSpace(line) {
+		case blockBegin, blockEnd:
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// part is a run of lines of the hosts file, inside Miner's block or not
+type part struct {
+	lines   []string
+	managed bool
+}
+
+// parts returns the hosts file split by splitBlock, in file order
+func parts(lines []string) []part {
+	before, block, after := splitBlock(lines)
+	return []part{{before, false}, {block, true}, {after, false}}
+}
+
+// joinBlock reassembles the hosts file, dropping the block when it is empty
+func joinBlock(before, block, after []string) []string {
+	out := append([]string{}, before...)
+	if len(block) > 0 {
+		out = append(out, blockBegin)
+		out = append(out, block...)
+		out = append(out, blockEnd)
+	}
+	return append(out, after...)
+}
+
+// read returns the lines of the hosts file
+func (m *Manager) read() ([]string, error) {
+	f, err := os.Open(m.hostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hosts file: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
 	if err := scanner.Err(); err != nil {
-		return false, fmt.Errorf("error reading hosts file: %w", err)
+		return nil, fmt.Errorf("error reading hosts file: %w", err)
+	}
+	return lines, nil
+}
+
+// write backs up the hosts file and atomically replaces it with lines
+func (m *Manager) write(lines []string) error {
+	if _, err := m.Backup(); err != nil {
+		return err
+	}
+	data := strings.Join(lines, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	return m.replace([]byte(data))
+}
+
+// replace atomically writes data to the hosts file, keeping its mode
+func (m *Manager) replace(data []byte) error {
+	info, err := os.Stat(m.hostsPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat hosts file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.hostsPath), ".hosts.miner-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp hosts file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp hosts file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp hosts file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temp hosts file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set hosts file mode: %w", err)
+	}
+	keepOwner(tmpPath, info)
+
+	if err := os.Rename(tmpPath, m.hostsPath); err != nil {
+		// A bind-mounted hosts file (e.g. in containers) cannot be replaced
+		m.log.Debug("cannot replace hosts file; rewriting it in place", "err", err)
+		if err := os.WriteFile(m.hostsPath, data, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to save hosts file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Backup copies the hosts file to a timestamped backup next to it and prunes
+// old backups. It returns the path of the backup.
+func (m *Manager) Backup() (string, error) {
+	data, err := os.ReadFile(m.hostsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read hosts file: %w", err)
+	}
+	path := m.hostsPath + backupPrefix + time.Now().Format(backupTimeLayout) + backupSuffix
+	if _, err := os.Stat(path); err == nil {
+		// Already backed up this second; keep the older state
+		return path, nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to back up hosts file: %w", err)
+	}
+	m.log.Debug("backed up hosts file", "path", path)
+
+	backups, err := m.Backups()
+	if err == nil && len(backups) > MaxBackups {
+		for _, old := range backups[MaxBackups:] {
+			_ = os.Remove(old.Path)
+		}
+	}
+	return path, nil
+}
+
+// Backup is a saved copy of the hosts file
+type Backup struct {
+	Path string
+	Time time.Time
+}
+
+// Backups returns the backups of the hosts file, newest first
+func (m *Manager) Backups() ([]Backup, error) {
+	pattern := m.hostsPath + backupPrefix + "*" + backupSuffix
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, path := range paths {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(path, m.hostsPath+backupPrefix), backupSuffix)
+		t, err := time.ParseInLocation(backupTimeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: path, Time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// Restore replaces the hosts file with the backup at path. The current file
+// is backed up first, so a restore can itself be rolled back.
+func (m *Manager) Restore(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if len(data) == 0 {
+		return errors.New("refusing to restore an empty backup")
+	}
+	if _, err := m.Backup(); err != nil {
+		return err
 	}
-	return false, nil
+	m.log.Debug("restoring hosts file", "backup", path, "path", m.hostsPath)
+	return m.replace(data)
 }
@@ -0,0 +1,327 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testManager returns a manager of a temp hosts file holding lines
+func testManager(t *testing.T, lines ...string) (*Manager, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(join(lines)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(path, nil), path
+}
+
+func join(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func readHosts(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAddEntry(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file []string
+		ips  []string
+		want []string
+	}{
+		{
+			name: "empty file",
+			ips:  []string{"127.0.0.1"},
+			want: []string{"# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"},
+		},
+		{
+			name: "user entries kept",
+			file: []string{"127.0.0.1\tlocalhost", "10.0.0.5 miner.test # mine"},
+			ips:  []string{"127.0.0.1", "::1"},
+			want: []string{"127.0.0.1\tlocalhost", "10.0.0.5 miner.test # mine", "# BEGIN miner", "127.0.0.1\tminer.test", "::1\tminer.test", "# END miner"},
+		},
+		{
+			name: "stale mapping replaced",
+			file: []string{"# BEGIN miner", "10.0.0.5\tminer.test", "127.0.0.1\tother.test", "# END miner", "# after"},
+			ips:  []string{"127.0.0.1"},
+			want: []string{"# BEGIN miner", "127.0.0.1\tother.test", "127.0.0.1\tminer.test", "# END miner", "# after"},
+		},
+		{
+			name: "BEGIN without END",
+			file: []string{"127.0.0.1\tlocalhost", "# BEGIN miner", "192.168.1.2\tnas"},
+			ips:  []string{"127.0.0.1"},
+			want: []string{"127.0.0.1\tlocalhost", "192.168.1.2\tnas", "# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"},
+		},
+		{
+			name: "END without BEGIN",
+			file: []string{"# END miner", "192.168.1.2\tnas"},
+			ips:  []string{"127.0.0.1"},
+			want: []string{"192.168.1.2\tnas", "# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"},
+		},
+		{
+			name: "stray BEGIN before the block",
+			file: []string{"# BEGIN miner", "192.168.1.2\tnas", "# BEGIN miner", "127.0.0.1\tother.test", "# END miner"},
+			ips:  []string{"127.0.0.1"},
+			want: []string{"192.168.1.2\tnas", "# BEGIN miner", "127.0.0.1\tother.test", "127.0.0.1\tminer.test", "# END miner"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, path := testManager(t, tt.file...)
+			if err := m.AddEntry("miner.test", tt.ips...); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := readHosts(t, path), join(tt.want); got != want {
+				t.Errorf("hosts =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestAddEntryInvalid(t *testing.T) {
+	m, path := testManager(t, "127.0.0.1\tlocalhost")
+	if err := m.AddEntry("miner.test"); err == nil {
+		t.Error("AddEntry without an address succeeded")
+	}
+	if err := m.AddEntry("miner.test", "127.0.0.1", "not-an-ip"); err == nil {
+		t.Error("AddEntry with an invalid address succeeded")
+	}
+	for _, domain := range []string{"", "miner.test\n0.0.0.0 bank.example", "miner.test evil.test", "miner..test", "-miner.test", "miner.test.", "miner_test", "a" + strings.Repeat(".a", 127)} {
+		if err := m.AddEntry(domain, "127.0.0.1"); err == nil {
+			t.Errorf("AddEntry(%q) succeeded", domain)
+		}
+	}
+	if got := readHosts(t, path); got != "127.0.0.1\tlocalhost\n" {
+		t.Errorf("hosts changed to %q", got)
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	for _, name := range []string{"miner.test", "localhost", "db-1.Miner.test", strings.Repeat("a", 63) + ".test"} {
+		if err := ValidateHostname(name); err != nil {
+			t.Errorf("ValidateHostname(%q) = %v", name, err)
+		}
+	}
+	if err := ValidateHostname(strings.Repeat("a", 64) + ".test"); err == nil {
+		t.Error("accepted a label longer than 63 characters")
+	}
+}
+
+func TestRemoveEntry(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file []string
+		want []string
+	}{
+		{
+			name: "block dropped once empty",
+			file: []string{"127.0.0.1\tlocalhost", "# BEGIN miner", "127.0.0.1\tminer.test", "::1\tminer.test", "# END miner"},
+			want: []string{"127.0.0.1\tlocalhost"},
+		},
+		{
+			name: "other managed entries kept",
+			file: []string{"# BEGIN miner", "127.0.0.1\tminer.test", "127.0.0.1\tother.test", "# END miner"},
+			want: []string{"# BEGIN miner", "127.0.0.1\tother.test", "# END miner"},
+		},
+		{
+			name: "user entry kept",
+			file: []string{"10.0.0.5\tminer.test", "# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"},
+			want: []string{"10.0.0.5\tminer.test"},
+		},
+		{
+			name: "only a user entry",
+			file: []string{"10.0.0.5\tminer.test"},
+			want: []string{"10.0.0.5\tminer.test"},
+		},
+		{
+			name: "BEGIN without END",
+			file: []string{"# BEGIN miner", "10.0.0.5\tminer.test"},
+			want: []string{"# BEGIN miner", "10.0.0.5\tminer.test"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, path := testManager(t, tt.file...)
+			if err := m.RemoveEntry("miner.test"); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := readHosts(t, path), join(tt.want); got != want {
+				t.Errorf("hosts =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// A stray BEGIN must not make the user's lines Miner's once a block follows
+func TestStrayBeginKeepsUserLines(t *testing.T) {
+	m, path := testManager(t, "# BEGIN miner", "192.168.1.2\tnas", "10.0.0.5\tminer.test")
+	if err := m.AddEntry("miner.test", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := m.Ownership("nas"); owner != User {
+		t.Errorf("Ownership(nas) = %s, want %s", owner, User)
+	}
+	if err := m.RemoveEntry("miner.test"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readHosts(t, path), "192.168.1.2\tnas\n10.0.0.5\tminer.test\n"; got != want {
+		t.Errorf("hosts = %q, want %q", got, want)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		file   []string
+		want   Ownership
+		wantIP string
+	}{
+		{"missing", []string{"127.0.0.1\tlocalhost", "# 127.0.0.1 miner.test"}, Missing, ""},
+		{"managed", []string{"# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"}, Managed, "127.0.0.1"},
+		{"user", []string{"10.0.0.5 other.test MINER.test # alias"}, User, "10.0.0.5"},
+		{"user line first", []string{"10.0.0.5\tminer.test", "# BEGIN miner", "127.0.0.1\tminer.test", "# END miner"}, User, "10.0.0.5"},
+		{"block first", []string{"# BEGIN miner", "127.0.0.1\tminer.test", "# END miner", "10.0.0.5\tminer.test"}, Managed, "127.0.0.1"},
+		{"after BEGIN without END", []string{"# BEGIN miner", "10.0.0.5\tminer.test"}, User, "10.0.0.5"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := testManager(t, tt.file...)
+			owner, err := m.Ownership("miner.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ip, err := m.Lookup("miner.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner != tt.want || ip != tt.wantIP {
+				t.Errorf("Ownership, Lookup = %s, %q, want %s, %q", owner, ip, tt.want, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestHasEntry(t *testing.T) {
+	m, _ := testManager(t, "# BEGIN miner", "127.0.0.1\tminer.test", "# END miner")
+	for _, tt := range []struct {
+		ips  []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"127.0.0.1", "::1"}, false},
+		{[]string{"10.0.0.5"}, false},
+	} {
+		if got, err := m.HasEntry("miner.test", tt.ips...); err != nil || got != tt.want {
+			t.Errorf("HasEntry(%v) = %v, %v, want %v", tt.ips, got, err, tt.want)
+		}
+	}
+}
+
+func TestWriteKeepsMode(t *testing.T) {
+	m, path := testManager(t, "127.0.0.1\tlocalhost")
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddEntry("miner.test", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".hosts.miner-*")); len(tmps) > 0 {
+		t.Errorf("temp files left: %v", tmps)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	original := "127.0.0.1\tlocalhost\n"
+	m, path := testManager(t, "127.0.0.1\tlocalhost")
+	if err := m.AddEntry("miner.test", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := m.Backups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Backups = %v, %v, want the one written by AddEntry", backups, err)
+	}
+	if got := readHosts(t, backups[0].Path); got != original {
+		t.Errorf("backup = %q, want %q", got, original)
+	}
+
+	if err := m.Restore(backups[0].Path); err != nil {
+		t.Fatal(err)
+	}
+	if got := readHosts(t, path); got != original {
+		t.Errorf("restored hosts = %q, want %q", got, original)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Restore(empty); err == nil {
+		t.Error("restored an empty backup")
+	}
+	if err := m.Restore(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("restored a missing backup")
+	}
+	if got := readHosts(t, path); got != original {
+		t.Errorf("hosts after failed restores = %q, want %q", got, original)
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	m, path := testManager(t, "127.0.0.1\tlocalhost")
+	old := time.Now().Add(-time.Hour)
+	var oldest string
+	for i := 0; i < MaxBackups+2; i++ {
+		p := path + backupPrefix + old.Add(time.Duration(i)*time.Minute).Format(backupTimeLayout) + backupSuffix
+		if err := os.WriteFile(p, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			oldest = p
+		}
+	}
+	// Not a backup: left alone
+	other := path + backupPrefix + "notes" + backupSuffix
+	if err := os.WriteFile(other, []byte("notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newest, err := m.Backup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups, err := m.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != MaxBackups || backups[0].Path != newest {
+		t.Fatalf("kept %d backups, newest %v; want %d, newest %s", len(backups), backups[0].Path, MaxBackups, newest)
+	}
+	for i := 1; i < len(backups); i++ {
+		if backups[i].Time.After(backups[i-1].Time) {
+			t.Errorf("Backups not newest first: %v", backups)
+		}
+	}
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("oldest backup not pruned: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("pruned a file that is not a backup: %v", err)
+	}
+}
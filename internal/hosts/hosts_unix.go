@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package hosts
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOwner gives path the owner and group of the file described by info
+func keepOwner(path string, info os.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(path, int(st.Uid), int(st.Gid))
+	}
+}
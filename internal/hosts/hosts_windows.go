@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package hosts
+
+import "os"
+
+// keepOwner is a no-op on Windows, where the replaced file inherits the
+// permissions of its directory
+func keepOwner(path string, info os.FileInfo) {}
@@ -0,0 +1,168 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockName is the name of the instance lock (and PID) file in a runtime dir
+const LockName = "miner.pid"
+
+// errWouldBlock is returned by the platform lock calls when another process
+// holds the lock
+var errWouldBlock = errors.New("lock is held by another process")
+
+// Owner identifies the process holding an instance lock
+type Owner struct {
+	PID  int
+	Mode string // tray, daemon or service
+}
+
+func (o Owner) String() string {
+	if o.PID == 0 {
+		return "unknown process"
+	}
+	return fmt.Sprintf("%s, pid %d", o.Mode, o.PID)
+}
+
+// LockedError is returned when another process holds the instance lock
+type LockedError struct {
+	Path  string
+	Owner Owner
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("Miner is already running (%s)", e.Owner)
+}
+
+// Lock is a held instance lock; it is released when the process exits
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Acquire takes the instance lock at path without blocking and records the
+// PID and mode of this process in it. If another process holds the lock a
+// *LockedError naming it is returned.
+func Acquire(path, mode string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create runtime dir: %w", err)
+	}
+	for {
+		f, err := lockPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			// The holder released and removed the file we locked; lock its
+			// successor at path instead
+			continue
+		}
+
+		// The lock is on the open file, so rewriting its content is safe
+		if err := f.Truncate(0); err == nil {
+			_, err = f.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), mode)), 0)
+		}
+		if err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, fmt.Errorf("failed to write instance lock: %w", err)
+		}
+		return &Lock{f: f, path: path}, nil
+	}
+}
+
+// openFile opens the lock file; tests replace it to interleave a release
+var openFile = os.OpenFile
+
+// lockPath opens and locks the file at path. It returns a nil file when the
+// file was replaced while waiting for the lock: Release removes the file
+// before unlocking it, so the lock of a removed file protects nothing.
+func lockPath(path string) (*os.File, error) {
+	f, err := openFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open instance lock: %w", err)
+	}
+	if err := lockFile(f, true); err != nil {
+		f.Close()
+		if errors.Is(err, errWouldBlock) {
+			owner, _ := ReadOwner(path)
+			return nil, &LockedError{Path: path, Owner: owner}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	locked, err := f.Stat()
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, fmt.Errorf("failed to stat instance lock: %w", err)
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(locked, current) {
+		unlockFile(f)
+		f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Check reports the owner of the lock at path if another process holds it.
+// It only needs read access, so unprivileged users can check the system lock.
+func Check(path string) (Owner, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Owner{}, false
+	}
+	defer f.Close()
+	if err := lockFile(f, false); err != nil {
+		if errors.Is(err, errWouldBlock) {
+			owner, _ := ReadOwner(path)
+			return owner, true
+		}
+		return Owner{}, false
+	}
+	unlockFile(f)
+	return Owner{}, false
+}
+
+// ReadOwner parses the PID and mode recorded in the lock file at path
+func ReadOwner(path string) (Owner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Owner{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return Owner{}, fmt.Errorf("empty instance lock %s", path)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Owner{}, fmt.Errorf("invalid instance lock %s: %w", path, err)
+	}
+	owner := Owner{PID: pid}
+	if len(fields) > 1 {
+		owner.Mode = fields[1]
+	}
+	return owner, nil
+}
+
+// Path returns the path of the lock file
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Release unlocks and removes the lock file
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	// Remove first: once unlocked another process may take over the file
+	os.Remove(l.path)
+	unlockFile(l.f)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,71 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockName)
+	l, err := Acquire(path, "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locked *LockedError
+	if _, err := Acquire(path, "tray"); !errors.As(err, &locked) || locked.Owner.Mode != "daemon" {
+		t.Fatalf("second Acquire = %v, want a LockedError naming the daemon", err)
+	}
+	if owner, held := Check(path); !held || owner.Mode != "daemon" {
+		t.Errorf("Check = %v, %v, want held by the daemon", owner, held)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, held := Check(path); held {
+		t.Error("Check reports the lock held after Release")
+	}
+	l, err = Acquire(path, "tray")
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	l.Release()
+}
+
+// A holder releasing between our open and our flock removes the file we
+// opened; its lock must not count, or a newcomer locking the new file at the
+// same path would run alongside us
+func TestAcquireAfterRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockName)
+	holder, err := Acquire(path, "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := false
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		f, err := os.OpenFile(name, flag, perm)
+		if !released {
+			released = true
+			holder.Release()
+		}
+		return f, err
+	}
+	defer func() { openFile = os.OpenFile }()
+
+	l, err := Acquire(path, "tray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+	locked, err := l.f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(locked, current) {
+		t.Fatalf("Acquire locked a removed file (path: %v)", err)
+	}
+	if _, err := Acquire(path, "daemon"); err == nil {
+		t.Error("a newcomer acquired the lock too")
+	}
+}
@@ -0,0 +1,195 @@
+package logfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeFormat prefixes every line written to a log file
+const TimeFormat = time.RFC3339
+
+// rotatedTimeLayout names rotated files; it has a fixed width, so that names
+// sort by time, and sub-second precision, so that rotations in the same second
+// do not collide
+const rotatedTimeLayout = "20060102-150405.000000000"
+
+// Options controls rotation of a log file
+type Options struct {
+	MaxSize  int64         // rotate when the file would exceed this many bytes (0 = no limit)
+	MaxAge   time.Duration // rotate when the file is older than this (0 = no limit)
+	MaxFiles int           // rotated files to keep (0 = keep all)
+}
+
+// Writer is an io.Writer appending timestamped lines to a log file that is
+// rotated by size and age. Rotated files are named <base>-<timestamp><ext>.
+type Writer struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	opened  time.Time
+	partial []byte
+}
+
+// Open opens (or creates) the log file at path for appending
+func Open(path string, opts Options) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log dir: %w", err)
+	}
+	w := &Writer{path: path, opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	w.size = info.Size()
+	w.opened = info.ModTime()
+	if w.size == 0 {
+		w.opened = time.Now()
+	}
+	return nil
+}
+
+// Path returns the path of the current log file
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write writes complete lines prefixed with the current time; a trailing
+// partial line is buffered until its newline arrives.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.partial, p...)
+	var out bytes.Buffer
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		out.WriteString(time.Now().Format(TimeFormat))
+		out.WriteByte(' ')
+		out.Write(data[:i+1])
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+
+	if out.Len() == 0 {
+		return len(p), nil
+	}
+	if w.shouldRotate(int64(out.Len())) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(out.Bytes())
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *Writer) shouldRotate(next int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.opts.MaxSize > 0 && w.size+next > w.opts.MaxSize {
+		return true
+	}
+	return w.opts.MaxAge > 0 && time.Since(w.opened) > w.opts.MaxAge
+}
+
+// rotate renames the current file aside, opens a fresh one and prunes old files
+func (w *Writer) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	rotated := w.rotatedName(time.Now())
+	if err := os.Rename(w.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// rotatedName returns the name of the file rotated at t, moved past t while
+// that name is taken (as with a coarse clock)
+func (w *Writer) rotatedName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	for {
+		name := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.path, ext), t.Format(rotatedTimeLayout), ext)
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+// prune removes rotated files beyond MaxFiles
+func (w *Writer) prune() {
+	if w.opts.MaxFiles <= 0 {
+		return
+	}
+	files := Rotated(w.path)
+	for len(files) > w.opts.MaxFiles {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// Close flushes any partial line and closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		fmt.Fprintf(w.f, "%s %s\n", time.Now().Format(TimeFormat), w.partial)
+		w.partial = nil
+	}
+	return w.f.Close()
+}
+
+// Rotated returns the rotated files of the log at path, oldest first
+func Rotated(path string) []string {
+	ext := filepath.Ext(path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext)
+	sort.Strings(matches)
+	return matches
+}
+
+// ParseLine splits a log line into its timestamp and message
+func ParseLine(line string) (time.Time, string, bool) {
+	ts, msg, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, line, false
+	}
+	t, err := time.Parse(TimeFormat, ts)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, msg, true
+}
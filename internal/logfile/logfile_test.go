@@ -0,0 +1,36 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Rotations within the same second must each keep their own file
+func TestRotateKeepsEveryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frankenphp.log")
+	w, err := Open(path, Options{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for _, file := range append(Rotated(path), path) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg, _ := ParseLine(strings.TrimSuffix(string(data), "\n"))
+		got = append(got, msg)
+	}
+	if want := "one two three four"; strings.Join(got, " ") != want {
+		t.Errorf("files hold %q, want %q in order", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats accepted by New
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Defaults used when no level or format is given
+const (
+	DefaultLevel  = "info"
+	DefaultFormat = FormatText
+)
+
+// New returns a logger writing records at or above level to w as text or JSON
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want %s or %s)", format, FormatText, FormatJSON)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error (case-insensitive; empty means info)
+func ParseLevel(level string) (slog.Level, error) {
+	if level == "" {
+		level = DefaultLevel
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	return lvl, nil
+}
+
+// OrDefault returns logger, or slog.Default() when logger is nil
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileName is the name of the install manifest in a state dir
+const FileName = "install.json"
+
+// Components that record changes
+const (
+	ComponentCLI        = "cli"
+	ComponentHosts      = "hosts"
+	ComponentService    = "service"
+	ComponentFrankenPHP = "frankenphp"
+	ComponentConfig     = "config"
+)
+
+// Kinds of recorded changes
+const (
+	KindFile         = "file"          // a file created at Path
+	KindDir          = "dir"           // a directory created at Path; removed only when empty
+	KindProfileLine  = "profile_line"  // Value appended to the shell profile at Path
+	KindProfileBlock = "profile_block" // the managed block in the shell profile at Path
+	KindHostsEntry   = "hosts_entry"   // Value mapped to IP in the hosts file at Path
+	KindService      = "service"       // the auto-start service; Value is its scope
+	KindConfigKey    = "config_key"    // the setting Value saved to the config file at Path
+)
+
+// Change is one modification made by `miner install`
+type Change struct {
+	Component string `json:"component"`
+	Kind      string `json:"kind"`
+	Path      string `json:"path,omitempty"`
+	Value     string `json:"value,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case KindFile:
+		return "file " + c.Path
+	case KindDir:
+		return "directory " + c.Path
+	case KindProfileLine, KindProfileBlock:
+		return "PATH entry in " + c.Path
+	case KindHostsEntry:
+		return fmt.Sprintf("hosts entry %s -> %s", c.Value, c.IP)
+	case KindService:
+		return c.Value + " auto-start service"
+	case KindConfigKey:
+		return fmt.Sprintf("setting %q in %s", c.Value, c.Path)
+	default:
+		return c.Kind + " " + c.Path
+	}
+}
+
+// Recorder receives the changes made by an installer step
+type Recorder interface {
+	Record(c Change)
+}
+
+// Manifest lists the changes made by install, in the order they were made
+type Manifest struct {
+	Version   string    `json:"version"`
+	Scope     string    `json:"scope"` // system or user
+	UpdatedAt time.Time `json:"updated_at"`
+	Changes   []Change  `json:"changes"`
+
+	path string
+}
+
+// New returns an empty manifest to be saved at path
+func New(path, version, scope string) *Manifest {
+	return &Manifest{Version: version, Scope: scope, path: path}
+}
+
+// Load reads the manifest at path. A missing manifest returns an error
+// matching os.ErrNotExist.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{path: path}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid install manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Open loads the manifest at path, or returns a new one if there is none yet
+func Open(path, version, scope string) (*Manifest, error) {
+	m, err := Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(path, version, scope), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.Version = version
+	return m, nil
+}
+
+// Path returns where the manifest is saved
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// Record appends c unless the manifest already holds it. It is safe to call
+// on a nil manifest, which records nothing.
+func (m *Manifest) Record(c Change) {
+	if m == nil || m.Has(c) {
+		return
+	}
+	m.Changes = append(m.Changes, c)
+}
+
+// Has reports whether the manifest holds c
+func (m *Manifest) Has(c Change) bool {
+	for _, existing := range m.Changes {
+		if existing == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Forget drops c from the manifest once it has been undone
+func (m *Manifest) Forget(c Change) {
+	for i, existing := range m.Changes {
+		if existing == c {
+			m.Changes = append(m.Changes[:i], m.Changes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reverse returns the changes in the order they must be undone
+func (m *Manifest) Reverse() []Change {
+	changes := make([]Change, 0, len(m.Changes))
+	for i := len(m.Changes) - 1; i >= 0; i-- {
+		changes = append(changes, m.Changes[i])
+	}
+	return changes
+}
+
+// Save writes the manifest, or removes it once it holds no changes
+func (m *Manifest) Save() error {
+	if len(m.Changes) == 0 {
+		if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove install manifest: %w", err)
+		}
+		return nil
+	}
+	m.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	if err := os.WriteFile(m.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write install manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Fake for commands it has no behavior for
+var ErrNotFound = errors.New("executable file not found")
+
+// ExitError is the error Fake processes exit with for a non-zero code
+type ExitError struct {
+	Code   int    // -1 when killed
+	Signal string // set when killed by a signal
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return "signal: " + e.Signal
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code, like exec.ExitError
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Behavior is the body of a fake process. It runs in its own goroutine once
+// the process is started and returns the exit code. It should return when it
+// receives a signal it does not ignore, or when the process is killed.
+type Behavior func(p *FakeProcess) int
+
+// Fake is an in-memory Runner for tests: it records every command started and
+// runs a Behavior instead of an executable
+type Fake struct {
+	mu        sync.Mutex
+	paths     map[string]string
+	behaviors map[string]Behavior
+	startErrs map[string]error
+	started   []*FakeProcess
+	nextPid   int
+}
+
+// NewFake returns a Fake that knows no commands
+func NewFake() *Fake {
+	return &Fake{
+		paths:     map[string]string{},
+		behaviors: map[string]Behavior{},
+		startErrs: map[string]error{},
+		nextPid:   1000,
+	}
+}
+
+// Handle runs b for commands started with path, and makes LookPath find path
+// by its name
+func (f *Fake) Handle(path string, b Behavior) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.behaviors[path] = b
+	f.paths[baseName(path)] = path
+}
+
+// FailStart makes starting path fail with err, as when it is not executable
+func (f *Fake) FailStart(path string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.startErrs[path] = err
+	f.paths[baseName(path)] = path
+}
+
+// LookPath returns the path registered for file
+func (f *Fake) LookPath(file string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if path, ok := f.paths[file]; ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s: %w", file, ErrNotFound)
+}
+
+// Start records cmd and runs its behavior
+func (f *Fake) Start(cmd *Cmd) (Process, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.startErrs[cmd.Path]; err != nil {
+		return nil, err
+	}
+	b, ok := f.behaviors[cmd.Path]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", cmd.Path, ErrNotFound)
+	}
+
+	f.nextPid++
+	recorded := *cmd
+	recorded.Args = append([]string(nil), cmd.Args...)
+	recorded.Env = append([]string(nil), cmd.Env...)
+	p := &FakeProcess{
+		Cmd:     recorded,
+		Stdout:  writerOrDiscard(cmd.Stdout),
+		Stderr:  writerOrDiscard(cmd.Stderr),
+		pid:     f.nextPid,
+		signals: make(chan os.Signal, 16),
+		killed:  make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	f.started = append(f.started, p)
+	go p.run(b)
+	return p, nil
+}
+
+// Started returns the processes started so far, oldest first
+func (f *Fake) Started() []*FakeProcess {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FakeProcess(nil), f.started...)
+}
+
+// FakeProcess is a process started by Fake
+type FakeProcess struct {
+	Cmd    Cmd // the command as started: argv, environment and working dir
+	Stdout io.Writer
+	Stderr io.Writer
+
+	pid      int
+	signals  chan os.Signal
+	killOnce sync.Once
+	killed   chan struct{}
+	exited   chan struct{}
+
+	mu       sync.Mutex
+	received []os.Signal
+	err      error
+}
+
+func (p *FakeProcess) run(b Behavior) {
+	code := make(chan int, 1)
+	go func() { code <- b(p) }()
+	select {
+	case c := <-code:
+		if c != 0 {
+			p.err = &ExitError{Code: c}
+		}
+	case <-p.killed:
+		p.err = &ExitError{Code: -1, Signal: "killed"}
+	}
+	close(p.exited)
+}
+
+// Pid returns the fake process ID
+func (p *FakeProcess) Pid() int {
+	return p.pid
+}
+
+// Wait blocks until the behavior returns or the process is killed
+func (p *FakeProcess) Wait() error {
+	<-p.exited
+	return p.err
+}
+
+// Signal delivers sig to the behavior; os.Kill kills the process
+func (p *FakeProcess) Signal(sig os.Signal) error {
+	if sig == os.Kill {
+		return p.Kill()
+	}
+	if p.Exited() {
+		return os.ErrProcessDone
+	}
+	p.mu.Lock()
+	p.received = append(p.received, sig)
+	p.mu.Unlock()
+	select {
+	case p.signals <- sig:
+	default:
+	}
+	return nil
+}
+
+// Kill ends the process at once, whatever its behavior does
+func (p *FakeProcess) Kill() error {
+	if p.Exited() {
+		return os.ErrProcessDone
+	}
+	p.mu.Lock()
+	p.received = append(p.received, os.Kill)
+	p.mu.Unlock()
+	p.killOnce.Do(func() { close(p.killed) })
+	return nil
+}
+
+// Signals receives the signals sent to the process, for its behavior
+func (p *FakeProcess) Signals() <-chan os.Signal {
+	return p.signals
+}
+
+// Killed is closed when the process is killed
+func (p *FakeProcess) Killed() <-chan struct{} {
+	return p.killed
+}
+
+// Received returns the signals sent to the process, including os.Kill
+func (p *FakeProcess) Received() []os.Signal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]os.Signal(nil), p.received...)
+}
+
+// Exited reports whether the process has exited
+func (p *FakeProcess) Exited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Exit returns a behavior that writes stdout and stderr and exits with code
+func Exit(code int, stdout, stderr string) Behavior {
+	return func(p *FakeProcess) int {
+		io.WriteString(p.Stdout, stdout)
+		io.WriteString(p.Stderr, stderr)
+		return code
+	}
+}
+
+// UntilSignal returns a behavior that runs until it receives any signal and
+// then exits with code
+func UntilSignal(code int) Behavior {
+	return func(p *FakeProcess) int {
+		select {
+		case <-p.Signals():
+			return code
+		case <-p.Killed():
+			return -1
+		}
+	}
+}
+
+// Delay returns a behavior that does nothing for d before running b, like a
+// process that is slow to start up
+func Delay(d time.Duration, b Behavior) Behavior {
+	return func(p *FakeProcess) int {
+		select {
+		case <-time.After(d):
+			return b(p)
+		case <-p.Killed():
+			return -1
+		}
+	}
+}
+
+func writerOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
+
+// baseName returns the last element of a slash or backslash separated path
+func baseName(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' || path[i] == '\\' {
+			return path[i+1:]
+		}
+	}
+	return path
+}
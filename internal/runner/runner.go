@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Cmd describes a command to start
+type Cmd struct {
+	Path   string
+	Args   []string // arguments, not including Path
+	Env    []string // nil inherits the environment of this process
+	Dir    string   // working directory; empty uses the current one
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	SysProcAttr *syscall.SysProcAttr
+}
+
+// Process is a started command
+type Process interface {
+	Pid() int
+	// Wait blocks until the process exits. A non-zero exit is an error with
+	// an ExitCode() int method, such as *exec.ExitError.
+	Wait() error
+	Signal(sig os.Signal) error
+	Kill() error
+}
+
+// Runner looks up and starts commands
+type Runner interface {
+	LookPath(file string) (string, error)
+	Start(cmd *Cmd) (Process, error)
+}
+
+// Exec runs commands as real processes with os/exec
+type Exec struct{}
+
+// LookPath searches for file in PATH like exec.LookPath
+func (Exec) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// Start starts cmd as a child process
+func (Exec) Start(c *Cmd) (Process, error) {
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Env, cmd.Dir = c.Env, c.Dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+	cmd.SysProcAttr = c.SysProcAttr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return execProcess{cmd}, nil
+}
+
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p execProcess) Pid() int                   { return p.cmd.Process.Pid }
+func (p execProcess) Wait() error                { return p.cmd.Wait() }
+func (p execProcess) Signal(sig os.Signal) error { return p.cmd.Process.Signal(sig) }
+func (p execProcess) Kill() error                { return p.cmd.Process.Kill() }
+
+// Run starts cmd with r and waits for it to exit
+func Run(r Runner, cmd *Cmd) error {
+	p, err := r.Start(cmd)
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+// Output runs cmd with r and returns its standard output
+func Output(r Runner, cmd *Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	c := *cmd
+	c.Stdout = &stdout
+	err := Run(r, &c)
+	return stdout.Bytes(), err
+}
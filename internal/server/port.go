@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ParsePortRange parses a fallback port range such as "8089-8099"
+func ParsePortRange(spec string) (int, int, error) {
+	lo, hi, ok := strings.Cut(spec, "-")
+	if !ok {
+		hi = lo
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	last, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range %q (want e.g. 8089-8099)", spec)
+	}
+	return first, last, nil
+}
+
+// SetPortRange enables automatic fallback to the first free port in
+// [first, last] when the configured port is taken. A zero range disables it.
+func (s *Server) SetPortRange(first, last int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portFirst, s.portLast = first, last
+}
+
+// Port returns the port FrankenPHP listens on: the fallback port if one was
+// chosen, the configured port otherwise.
+func (s *Server) Port() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activePort != "" {
+		return s.activePort
+	}
+	return s.port
+}
+
+// selectPort returns the configured port if it is free, else the first free
+// port in the fallback range. Callers must hold s.mu.
+func (s *Server) selectPort() (string, error) {
+	if !portInUse(s.port) {
+		return s.port, nil
+	}
+
+	owner := ""
+	if n, err := strconv.Atoi(s.port); err == nil {
+		owner = portOwner(n)
+	}
+	inUse := fmt.Sprintf("port %s is already in use", s.port)
+	if owner != "" {
+		inUse += " by " + owner
+	}
+
+	if s.portFirst == 0 {
+		return "", fmt.Errorf("%s; free it, change \"port\" in the config or set \"port_range\" to fall back automatically", inUse)
+	}
+	for p := s.portFirst; p <= s.portLast; p++ {
+		candidate := strconv.Itoa(p)
+		if candidate != s.port && portFree(candidate) {
+			s.log.Warn(inUse+"; falling back to another port", "port", candidate)
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s and no free port in fallback range %d-%d", inUse, s.portFirst, s.portLast)
+}
+
+// portInUse reports whether another process is listening on port
+func portInUse(port string) bool {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err == nil {
+		ln.Close()
+		return false
+	}
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true
+	}
+	// Listening may fail for other reasons (e.g. privileged port); fall back
+	// to checking whether something accepts connections
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// portFree reports whether we can bind port ourselves
+func portFree(port string) bool {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+// portOwner is only implemented on Linux (via /proc)
+func portOwner(port int) string { return "" }
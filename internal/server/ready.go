@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultReadyTimeout is how long Start waits for FrankenPHP to answer requests
+const DefaultReadyTimeout = 15 * time.Second
+
+const (
+	readyPollInterval = 200 * time.Millisecond
+	readyProbeTimeout = 2 * time.Second
+	// readyBodyLimit caps how much of the response is searched for the Adminer marker
+	readyBodyLimit = 256 << 10
+)
+
+var errStoppedStarting = errors.New("server was stopped before it became ready")
+
+// SetReadyTimeout sets how long Start waits for FrankenPHP to become ready
+func (s *Server) SetReadyTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readyTimeout = d
+}
+
+// waitReady polls the listen address until Adminer answers, the process
+// exits, stop is closed or the ready timeout expires.
+func (s *Server) waitReady(proc *process, stop chan struct{}) error {
+	s.mu.Lock()
+	timeout := s.readyTimeout
+	s.mu.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-stop:
+			return errStoppedStarting
+		case <-proc.exited:
+			return fmt.Errorf("FrankenPHP exited during startup: %s", proc.exit)
+		case <-deadline.C:
+			return fmt.Errorf("FrankenPHP not ready after %s: %w", timeout, lastErr)
+		case <-ticker.C:
+			if lastErr = s.probe(); lastErr == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// probe performs one HTTP request against the local listen address and checks
+// that the response comes from Adminer.
+func (s *Server) probe() error {
+	s.mu.Lock()
+	secure, domain := s.tlsDir != "", s.domain
+	s.mu.Unlock()
+	return Probe(domain, s.Port(), secure)
+}
+
+// Probe requests / from 127.0.0.1:port with the Host header (and SNI) set to
+// domain and checks that the response comes from Adminer. It does not need a
+// hosts entry for domain.
+func Probe(domain, port string, secure bool) error {
+	client := &http.Client{
+		Timeout: readyProbeTimeout,
+		// Adminer may redirect; the first response is enough to prove it is served
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	scheme := "http"
+	if secure {
+		scheme = "https"
+		// Connect to the loopback address but present the domain via SNI; the
+		// probe checks liveness, trust of the local CA is not its concern
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: domain, InsecureSkipVerify: true},
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, scheme+"://"+net.JoinHostPort("127.0.0.1", port)+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Host = domain
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, readyBodyLimit))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), "Adminer") {
+		return fmt.Errorf("unexpected response from %s: %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+// startupError describes a failed start, including the captured stderr
+func startupError(err error, exit *ExitStatus) error {
+	if exit == nil || len(exit.StderrTail) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w\nFrankenPHP stderr:\n  %s", err, strings.Join(exit.StderrTail, "\n  "))
+}
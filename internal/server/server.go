@@ -1,101 +1,444 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/4nkitd/miner/internal/caddyfile"
+	"github.com/4nkitd/miner/internal/frankenphp"
+	"github.com/4nkitd/miner/internal/runner"
+	"github.com/4nkitd/miner/internal/tlsca"
 )
 
+// stderrTailLines is the number of stderr lines kept for crash reports
+const stderrTailLines = 20
+
+// ErrNotRunning is returned by Stop when there is no process to stop
+var ErrNotRunning = errors.New("server is not running")
+
+// DefaultStopTimeout is how long Stop waits after SIGTERM before sending SIGKILL
+const DefaultStopTimeout = 10 * time.Second
+
 type Server struct {
-	port          string
-	domain        string
-	assetsDir     string
-	running       bool
-	frankenphpCmd *exec.Cmd
+	port         string
+	domain       string
+	aliases      []string
+	assetsDir    string
+	binary       string // FrankenPHP binary; empty looks it up in PATH
+	restart      RestartOptions
+	stopTimeout  time.Duration
+	readyTimeout time.Duration
+	portFirst    int // fallback port range; zero disables fallback
+	portLast     int
+	site         caddyfile.Site // Caddyfile options; domain, port and root are filled in at launch
+	caddyfile    string         // where the generated Caddyfile is written
+	tlsDir       string         // local CA and certificate dir; empty serves plain HTTP
+	logWriter    io.Writer      // receives FrankenPHP stdout and stderr; nil disables file logging
+	console      bool           // copy FrankenPHP output to our stdout/stderr
+	runner       runner.Runner  // starts FrankenPHP; a fake in tests
+	log          *slog.Logger
+
+	mu          sync.Mutex
+	activePort  string // port chosen for the current process
+	state       State
+	proc        *process
+	stopCh      chan struct{} // closed by Stop to end supervision
+	doneCh      chan struct{} // closed when the supervisor goroutine returns
+	restarts    int
+	lastExit    *ExitStatus
+	subscribers map[chan Transition]struct{}
+}
+
+// Status is a snapshot of the supervised FrankenPHP process
+type Status struct {
+	State    State
+	PID      int
+	Port     string
+	Restarts int
+	LastExit *ExitStatus // nil until the process has exited at least once
+}
+
+// process is a launched FrankenPHP child
+type process struct {
+	child  runner.Process
+	tail   *tailBuffer
+	exited chan struct{} // closed once the process has been reaped
+	exit   *ExitStatus   // valid after exited is closed
+}
+
+func (p *process) wait() {
+	p.exit = newExitStatus(p.child.Wait(), p.tail)
+	close(p.exited)
+}
+
+func (p *process) signal(sig os.Signal) {
+	if p == nil || p.child == nil {
+		return
+	}
+	if err := p.child.Signal(sig); err != nil {
+		// If the signal fails, force kill
+		p.child.Kill()
+	}
 }
 
 func NewServer(port, domain, assetsDir string) *Server {
 	return &Server{
-		port:      port,
-		domain:    domain,
-		assetsDir: assetsDir,
-		running:   false,
+		port:         port,
+		domain:       domain,
+		assetsDir:    assetsDir,
+		restart:      DefaultRestartOptions(),
+		stopTimeout:  DefaultStopTimeout,
+		readyTimeout: DefaultReadyTimeout,
+		site:         caddyfile.Site{Compression: true},
+		caddyfile:    filepath.Join(os.TempDir(), "miner", "Caddyfile"),
+		console:      true,
+		runner:       runner.Exec{},
+		log:          slog.Default(),
+		state:        StateStopped,
+	}
+}
+
+// SetAddress changes the port and domains served from the next start on;
+// aliases are served alongside domain
+func (s *Server) SetAddress(port, domain string, aliases ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.port = port
+	s.domain = domain
+	s.aliases = aliases
+}
+
+// SetBinary runs the FrankenPHP binary at path; a stable path such as the
+// current link of a managed store picks up version switches on the next
+// launch. If path does not exist, frankenphp is looked up in PATH.
+func (s *Server) SetBinary(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binary = path
+}
+
+// SetRunner changes how the FrankenPHP process is started; tests pass a
+// runner.Fake. It must be called before Start.
+func (s *Server) SetRunner(r runner.Runner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runner = r
+}
+
+// findBinary returns the FrankenPHP binary to launch given the configured one
+func findBinary(r runner.Runner, binary string) (string, error) {
+	if binary != "" {
+		if _, err := os.Stat(binary); err == nil {
+			return binary, nil
+		}
+	}
+	path, err := r.LookPath("frankenphp")
+	if err != nil {
+		return "", fmt.Errorf("frankenphp not found. Install it with: miner frankenphp install %s", frankenphp.DefaultVersion)
+	}
+	return path, nil
+}
+
+// checkBinary refuses FrankenPHP releases older than frankenphp.MinVersion. A
+// binary that does not report its version is allowed to try.
+func (s *Server) checkBinary() error {
+	s.mu.Lock()
+	binary, r := s.binary, s.runner
+	s.mu.Unlock()
+	path, err := findBinary(r, binary)
+	if err != nil {
+		return err
+	}
+	version, err := frankenphp.CheckVersion(r, path)
+	if version == "" && err != nil {
+		s.log.Warn("cannot determine the FrankenPHP version", "path", path, "err", err)
+		return nil
+	}
+	return err
+}
+
+// SetSite configures the generated Caddyfile (headers, access log, limits,
+// compression) and the path it is written to before each launch.
+func (s *Server) SetSite(site caddyfile.Site, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.site = site
+	s.caddyfile = path
+}
+
+// SetLog sends FrankenPHP's stdout and stderr to w
+func (s *Server) SetLog(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logWriter = w
+}
+
+// SetConsole controls whether FrankenPHP output is copied to our stdout/stderr
+func (s *Server) SetConsole(console bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.console = console
+}
+
+// SetLogger sets the logger for lifecycle and supervisor events. It must be
+// called before Start.
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = logger
+}
+
+// SetTLS serves Adminer over HTTPS with a certificate for the domain issued
+// by the local CA in dir (created on first start). An empty dir disables TLS.
+func (s *Server) SetTLS(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsDir = dir
+}
+
+// Caddyfile renders the Caddyfile FrankenPHP is (or would be) started with
+func (s *Server) Caddyfile() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	port := s.activePort
+	if port == "" {
+		port = s.port
+	}
+	return s.renderCaddyfile(port)
+}
+
+func (s *Server) renderCaddyfile(port string) (string, error) {
+	site := s.site
+	site.Domain = s.domain
+	site.Aliases = s.aliases
+	site.Port = port
+	site.Root = s.assetsDir
+	if s.tlsDir != "" {
+		site.TLSCert = filepath.Join(s.tlsDir, tlsca.CertFile)
+		site.TLSKey = filepath.Join(s.tlsDir, tlsca.KeyFile)
 	}
+	return caddyfile.Render(site)
+}
+
+// SetRestartOptions configures how the supervisor restarts FrankenPHP after it exits
+func (s *Server) SetRestartOptions(opts RestartOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restart = opts
 }
 
+// Start launches FrankenPHP and blocks until it answers HTTP requests. If it
+// does not become ready in time, the process is killed and the error includes
+// the tail of its stderr.
 func (s *Server) Start() error {
-	if s.running {
+	if err := s.checkBinary(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	switch s.state {
+	case StateStarting, StateRunning:
+		s.mu.Unlock()
 		return fmt.Errorf("server is already running")
+	case StateStopping:
+		s.mu.Unlock()
+		return fmt.Errorf("server is stopping")
 	}
 
-	frankenphpPath, err := exec.LookPath("frankenphp")
+	s.setState(StateStarting, nil)
+	proc, err := s.launch()
 	if err != nil {
-		return fmt.Errorf("frankenphp not found. Install it with: curl https://frankenphp.dev/install.sh | sh")
+		s.setState(StateStopped, nil)
+		s.mu.Unlock()
+		return err
+	}
+
+	s.proc = proc
+	s.stopCh = make(chan struct{})
+	s.doneCh = make(chan struct{})
+	s.restarts = 0
+	ready := make(chan error, 1)
+	go s.supervise(proc, s.stopCh, s.doneCh, ready, s.restart)
+	s.mu.Unlock()
+
+	if err := <-ready; err != nil {
+		return err
+	}
+	s.log.Info("FrankenPHP started", "url", s.URL(), "pid", s.Status().PID)
+	return nil
+}
+
+// launch starts a new FrankenPHP process
+func (s *Server) launch() (*process, error) {
+	frankenphpPath, err := findBinary(s.runner, s.binary)
+	if err != nil {
+		return nil, err
 	}
 
 	// Ensure assets directory exists and contains adminer.php
 	adminerPath := filepath.Join(s.assetsDir, "adminer.php")
 	if _, err := os.Stat(adminerPath); err != nil {
-		return fmt.Errorf("adminer.php not found in assets directory: %w", err)
+		return nil, fmt.Errorf("adminer.php not found in assets directory: %w", err)
 	}
 
-	// Use php-server mode; set working directory to assetsDir so adminer.php is document root
-	// Bind explicitly to the requested domain:port using --listen if available, else rely on hosts + default
-	// FrankenPHP's php-server listens on 3000 by default; we need port 80
-	// Bind only to the port; rely on hosts file + Host header for domain routing
-	listen := ":" + s.port
-
-	// Command: frankenphp php-server -r <assetsDir> --listen :port
-	args := []string{"php-server", "-r", s.assetsDir, "--listen", listen}
+	port, err := s.selectPort()
+	if err != nil {
+		return nil, err
+	}
+	s.activePort = port
 
-	s.frankenphpCmd = exec.Command(frankenphpPath, args...)
-	s.frankenphpCmd.Dir = s.assetsDir
-	s.frankenphpCmd.Stdout = os.Stdout
-	s.frankenphpCmd.Stderr = os.Stderr
+	if s.tlsDir != "" {
+		if _, _, err := tlsca.EnsureLeaf(s.tlsDir, append([]string{s.domain}, s.aliases...)); err != nil {
+			return nil, fmt.Errorf("failed to prepare TLS certificate: %w", err)
+		}
+	}
 
-	if err := s.frankenphpCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start FrankenPHP php-server: %w", err)
+	// Generate the Caddyfile; the site block matches only the configured domains
+	content, err := s.renderCaddyfile(port)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.caddyfile), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create Caddyfile dir: %w", err)
+	}
+	if err := os.WriteFile(s.caddyfile, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write Caddyfile: %w", err)
 	}
 
-	s.running = true
-	fmt.Printf("FrankenPHP php-server started on %s\n", s.URL())
+	// Command: frankenphp run --config <Caddyfile> --adapter caddyfile
+	args := []string{"run", "--config", s.caddyfile, "--adapter", "caddyfile"}
 
-	go func() {
-		if err := s.frankenphpCmd.Wait(); err != nil {
-			fmt.Printf("FrankenPHP exited: %v\n", err)
-			s.running = false
-		}
-	}()
+	proc := &process{
+		tail:   newTailBuffer(stderrTailLines),
+		exited: make(chan struct{}),
+	}
+	cmd := &runner.Cmd{Path: frankenphpPath, Args: args, Dir: s.assetsDir}
+	stdout, stderr := []io.Writer{}, []io.Writer{proc.tail}
+	if s.logWriter != nil {
+		stdout = append(stdout, s.logWriter)
+		stderr = append(stderr, s.logWriter)
+	}
+	if s.console || s.logWriter == nil {
+		stdout = append(stdout, os.Stdout)
+		stderr = append(stderr, os.Stderr)
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
 
-	return nil
+	s.log.Debug("launching FrankenPHP", "binary", frankenphpPath, "args", args, "dir", s.assetsDir)
+	if proc.child, err = s.runner.Start(cmd); err != nil {
+		return nil, fmt.Errorf("failed to start FrankenPHP: %w", err)
+	}
+	go proc.wait()
+	return proc, nil
 }
 
+// Stop ends supervision and terminates FrankenPHP, blocking until the process
+// has exited. The process is killed if it does not exit within the stop timeout.
 func (s *Server) Stop() error {
-	if !s.running {
-		return fmt.Errorf("server is not running")
+	s.mu.Lock()
+	// A crashed server may still have a restart pending in the supervisor
+	supervised := s.doneCh != nil && !isClosed(s.doneCh)
+	if !s.state.Active() && !(s.state == StateCrashed && supervised) {
+		s.mu.Unlock()
+		return ErrNotRunning
 	}
 
-	if s.frankenphpCmd != nil && s.frankenphpCmd.Process != nil {
-		// Send SIGTERM for graceful shutdown
-		if err := s.frankenphpCmd.Process.Signal(syscall.SIGTERM); err != nil {
-			// If SIGTERM fails, force kill
-			s.frankenphpCmd.Process.Kill()
-		}
-	}
+	// Stop supervision first so the exit below is not treated as a crash
+	s.setState(StateStopping, nil)
+	close(s.stopCh)
+	proc, done := s.proc, s.doneCh
+	s.mu.Unlock()
+
+	// Send SIGTERM for graceful shutdown
+	proc.signal(syscall.SIGTERM)
 
-	s.running = false
+	select {
+	case <-done:
+	case <-time.After(s.stopTimeout):
+		s.log.Warn("FrankenPHP did not exit in time; killing it", "timeout", s.stopTimeout)
+		proc.signal(os.Kill)
+		<-done
+	}
 	return nil
 }
 
+// Restart stops FrankenPHP if it is running and starts it again
+func (s *Server) Restart() error {
+	if err := s.Stop(); err != nil && !errors.Is(err, ErrNotRunning) {
+		return err
+	}
+	return s.Start()
+}
+
+// IsRunning reports whether the server is starting or running
 func (s *Server) IsRunning() bool {
-	return s.running
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Active()
+}
+
+// Done returns a channel that is closed when supervision started by the last
+// Start ends, either through Stop or because FrankenPHP will not be restarted.
+func (s *Server) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doneCh == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return s.doneCh
+}
+
+// State returns the current lifecycle state
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Status returns the current supervisor state, including the last exit code
+// and stderr tail if FrankenPHP has exited.
+func (s *Server) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Status{
+		State:    s.state,
+		Port:     s.port,
+		Restarts: s.restarts,
+		LastExit: s.lastExit,
+	}
+	if s.activePort != "" {
+		st.Port = s.activePort
+	}
+	if s.state == StateRunning && s.proc != nil && s.proc.child != nil {
+		st.PID = s.proc.child.Pid()
+	}
+	return st
 }
 
 func (s *Server) URL() string {
-	if s.port == "80" {
-		return fmt.Sprintf("http://%s", s.domain)
+	port := s.Port()
+	s.mu.Lock()
+	secure, domain := s.tlsDir != "", s.domain
+	s.mu.Unlock()
+
+	switch {
+	case secure && port == "443":
+		return fmt.Sprintf("https://%s", domain)
+	case secure:
+		return fmt.Sprintf("https://%s:%s", domain, port)
+	case port == "80":
+		return fmt.Sprintf("http://%s", domain)
+	default:
+		return fmt.Sprintf("http://%s:%s", domain, port)
 	}
-	return fmt.Sprintf("http://%s:%s", s.domain, s.port)
 }
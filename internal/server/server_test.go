@@ -0,0 +1,353 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/4nkitd/miner/internal/caddyfile"
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// testServer returns a server on port whose FrankenPHP is a fake process
+// running serve, and the fake that records it
+func testServer(t *testing.T, port string, serve runner.Behavior) (*Server, *runner.Fake) {
+	t.Helper()
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "assets")
+	if err := os.MkdirAll(assets, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(assets, "adminer.php"), []byte("<?php"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Only checked for existence; the fake runs in its place
+	binary := filepath.Join(dir, "frankenphp")
+	if err := os.WriteFile(binary, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := runner.NewFake()
+	fake.Handle(binary, func(p *runner.FakeProcess) int {
+		if len(p.Cmd.Args) > 0 && p.Cmd.Args[0] == "version" {
+			fmt.Fprintln(p.Stdout, "FrankenPHP v1.9.1 PHP 8.4.12 Caddy v2.10.2")
+			return 0
+		}
+		return serve(p)
+	})
+
+	s := NewServer(port, "miner.test", assets)
+	s.SetBinary(binary)
+	s.SetRunner(fake)
+	s.SetSite(caddyfile.Site{}, filepath.Join(dir, "Caddyfile"))
+	s.SetConsole(false)
+	s.SetLog(io.Discard)
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.SetRestartOptions(RestartOptions{Policy: RestartNever})
+	t.Cleanup(func() { s.Stop() })
+	return s, fake
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// adminer returns a behavior that answers like Adminer on port until it is
+// signalled (exit 0, unless it ignores signals) or receives from crash (exit 2)
+func adminer(port string, crash <-chan struct{}, ignoreSignals bool) runner.Behavior {
+	return func(p *runner.FakeProcess) int {
+		signals := p.Signals()
+		if ignoreSignals {
+			signals = nil
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:"+port)
+		if err != nil {
+			fmt.Fprintln(p.Stderr, err)
+			return 1
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "<title>Login - Adminer</title>")
+		})}
+		go srv.Serve(ln)
+		defer srv.Close()
+
+		select {
+		case <-signals:
+			return 0
+		case <-p.Killed():
+			return -1
+		case <-crash:
+			fmt.Fprintln(p.Stderr, "panic: boom")
+			return 2
+		}
+	}
+}
+
+// runs returns the `frankenphp run` processes started by fake
+func runs(fake *runner.Fake) []*runner.FakeProcess {
+	var procs []*runner.FakeProcess
+	for _, p := range fake.Started() {
+		if len(p.Cmd.Args) > 0 && p.Cmd.Args[0] == "run" {
+			procs = append(procs, p)
+		}
+	}
+	return procs
+}
+
+// waitState waits for s to reach want
+func waitState(t *testing.T, s *Server, want State) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s, want %s", s.State(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerStartStop(t *testing.T) {
+	port := freePort(t)
+	s, fake := testServer(t, port, adminer(port, nil, false))
+
+	if s.IsRunning() {
+		t.Fatal("IsRunning before Start")
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !s.IsRunning() || s.State() != StateRunning {
+		t.Fatalf("after Start: IsRunning = %v, state %s", s.IsRunning(), s.State())
+	}
+	if err := s.Start(); err == nil {
+		t.Error("second Start succeeded while running")
+	}
+
+	procs := runs(fake)
+	if len(procs) != 1 {
+		t.Fatalf("launched %d processes, want 1", len(procs))
+	}
+	proc := procs[0]
+	want := []string{"run", "--config", s.caddyfile, "--adapter", "caddyfile"}
+	if !reflect.DeepEqual(proc.Cmd.Args, want) || proc.Cmd.Dir != s.assetsDir {
+		t.Errorf("launched %v in %s, want %v in %s", proc.Cmd.Args, proc.Cmd.Dir, want, s.assetsDir)
+	}
+	if st := s.Status(); st.PID != proc.Pid() || st.Port != port {
+		t.Errorf("Status = %+v, want PID %d on port %s", st, proc.Pid(), port)
+	}
+	if data, err := os.ReadFile(s.caddyfile); err != nil || !strings.Contains(string(data), "miner.test:"+port) {
+		t.Errorf("Caddyfile = %q, %v", data, err)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if s.IsRunning() || s.State() != StateStopped {
+		t.Errorf("after Stop: IsRunning = %v, state %s", s.IsRunning(), s.State())
+	}
+	if got := proc.Received(); !reflect.DeepEqual(got, []os.Signal{syscall.SIGTERM}) {
+		t.Errorf("signals = %v, want SIGTERM only", got)
+	}
+	if exit := s.Status().LastExit; exit == nil || exit.Code != 0 {
+		t.Errorf("LastExit = %v, want code 0", exit)
+	}
+	if err := s.Stop(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("second Stop = %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestServerCrashDuringStartup(t *testing.T) {
+	port := freePort(t)
+	s, fake := testServer(t, port, runner.Exit(1, "", "Error: adapting config: boom\n"))
+	// Not ready yet, so not restarted whatever the policy
+	s.SetRestartOptions(RestartOptions{Policy: RestartAlways, InitialBackoff: time.Millisecond})
+
+	err := s.Start()
+	if err == nil || !strings.Contains(err.Error(), "exited during startup") || !strings.Contains(err.Error(), "adapting config: boom") {
+		t.Fatalf("Start = %v, want the startup exit with its stderr", err)
+	}
+	if s.IsRunning() || s.State() != StateCrashed {
+		t.Errorf("IsRunning = %v, state %s, want crashed", s.IsRunning(), s.State())
+	}
+	if exit := s.Status().LastExit; exit == nil || exit.Code != 1 {
+		t.Errorf("LastExit = %v, want code 1", exit)
+	}
+	<-s.Done()
+	if n := len(runs(fake)); n != 1 {
+		t.Errorf("launched %d processes, want 1", n)
+	}
+}
+
+func TestServerCrashRestarts(t *testing.T) {
+	port := freePort(t)
+	crash := make(chan struct{})
+	s, fake := testServer(t, port, adminer(port, crash, false))
+	s.SetRestartOptions(RestartOptions{Policy: RestartOnFailure, MaxRestarts: 3, InitialBackoff: 10 * time.Millisecond, ResetAfter: time.Minute})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	transitions, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	crash <- struct{}{} // only the first process crashes
+	var seen []State
+	for len(seen) == 0 || seen[len(seen)-1] != StateRunning {
+		select {
+		case tr := <-transitions:
+			seen = append(seen, tr.To)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no restart; transitions %v", seen)
+		}
+	}
+	if want := []State{StateCrashed, StateStarting, StateRunning}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("transitions = %v, want %v", seen, want)
+	}
+
+	st := s.Status()
+	if st.Restarts != 1 || st.LastExit == nil || st.LastExit.Code != 2 {
+		t.Fatalf("Status = %+v, want 1 restart after exit code 2", st)
+	}
+	if tail := st.LastExit.StderrTail; len(tail) == 0 || tail[len(tail)-1] != "panic: boom" {
+		t.Errorf("stderr tail = %q", tail)
+	}
+	procs := runs(fake)
+	if len(procs) != 2 || st.PID != procs[1].Pid() {
+		t.Errorf("launched %d processes, PID %d", len(procs), st.PID)
+	}
+}
+
+func TestServerCrashWithoutRestart(t *testing.T) {
+	port := freePort(t)
+	crash := make(chan struct{})
+	s, fake := testServer(t, port, adminer(port, crash, false))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	close(crash)
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervision did not end after the crash")
+	}
+	if s.IsRunning() || s.State() != StateCrashed {
+		t.Errorf("IsRunning = %v, state %s, want crashed", s.IsRunning(), s.State())
+	}
+	if st := s.Status(); st.PID != 0 || st.LastExit == nil || st.LastExit.Code != 2 {
+		t.Errorf("Status = %+v, want no PID and exit code 2", st)
+	}
+	if err := s.Stop(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Stop after the crash = %v, want %v", err, ErrNotRunning)
+	}
+	if n := len(runs(fake)); n != 1 {
+		t.Errorf("launched %d processes, want 1", n)
+	}
+}
+
+func TestServerStopDuringRestartBackoff(t *testing.T) {
+	port := freePort(t)
+	crash := make(chan struct{})
+	s, fake := testServer(t, port, adminer(port, crash, false))
+	s.SetRestartOptions(RestartOptions{Policy: RestartAlways, MaxRestarts: 3, InitialBackoff: time.Minute, ResetAfter: time.Minute})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	close(crash)
+	// Waiting out the backoff before the relaunch
+	waitState(t, s, StateStarting)
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop during the backoff: %v", err)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervision did not end")
+	}
+	if s.State() != StateStopped {
+		t.Errorf("state = %s, want stopped", s.State())
+	}
+	if n := len(runs(fake)); n != 1 {
+		t.Errorf("launched %d processes, want 1", n)
+	}
+}
+
+func TestServerSlowStartup(t *testing.T) {
+	port := freePort(t)
+	s, _ := testServer(t, port, runner.Delay(300*time.Millisecond, adminer(port, nil, false)))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start of a slow but working server: %v", err)
+	}
+	if !s.IsRunning() {
+		t.Error("not running after a slow start")
+	}
+}
+
+func TestServerStartupTimeout(t *testing.T) {
+	port := freePort(t)
+	s, fake := testServer(t, port, runner.Delay(time.Minute, adminer(port, nil, false)))
+	s.SetReadyTimeout(500 * time.Millisecond)
+
+	if err := s.Start(); err == nil || !strings.Contains(err.Error(), "not ready after") {
+		t.Fatalf("Start = %v, want a readiness timeout", err)
+	}
+	if s.IsRunning() {
+		t.Error("IsRunning after the timeout")
+	}
+	procs := runs(fake)
+	if len(procs) != 1 || !procs[0].Exited() || !reflect.DeepEqual(procs[0].Received(), []os.Signal{os.Kill}) {
+		t.Errorf("the process that never became ready was not killed")
+	}
+}
+
+func TestServerStopKillsUnresponsiveProcess(t *testing.T) {
+	port := freePort(t)
+	s, fake := testServer(t, port, adminer(port, nil, true))
+	s.stopTimeout = 100 * time.Millisecond
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	waitState(t, s, StateStopped)
+	proc := runs(fake)[0]
+	if got := proc.Received(); !reflect.DeepEqual(got, []os.Signal{syscall.SIGTERM, os.Kill}) {
+		t.Errorf("signals = %v, want SIGTERM then kill", got)
+	}
+	if exit := s.Status().LastExit; exit == nil || exit.Code != -1 {
+		t.Errorf("LastExit = %v, want -1 (killed)", exit)
+	}
+}
+
+func TestServerLaunchFailure(t *testing.T) {
+	port := freePort(t)
+	s, fake := testServer(t, port, adminer(port, nil, false))
+	fake.FailStart(s.binary, errors.New("permission denied"))
+
+	if err := s.Start(); err == nil || !strings.Contains(err.Error(), "failed to start FrankenPHP") {
+		t.Fatalf("Start = %v, want a launch failure", err)
+	}
+	if s.IsRunning() || s.State() != StateStopped {
+		t.Errorf("IsRunning = %v, state %s, want stopped", s.IsRunning(), s.State())
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import "time"
+
+// State is a lifecycle state of the supervised FrankenPHP process.
+//
+//	Stopped → Starting → Running → Stopping → Stopped
+//	                        ↓
+//	                     Crashed → Starting (restart) …
+type State string
+
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateStopping State = "stopping"
+	StateCrashed  State = "crashed"
+)
+
+// Active reports whether the server is running or about to run
+func (st State) Active() bool {
+	return st == StateStarting || st == StateRunning
+}
+
+// Transition describes a state change emitted to subscribers
+type Transition struct {
+	From State
+	To   State
+	Time time.Time
+	Exit *ExitStatus // set when the transition was caused by the process exiting
+}
+
+// subscriberBuffer is the channel capacity for each subscriber; transitions
+// are dropped for subscribers that fall this far behind.
+const subscriberBuffer = 16
+
+// Subscribe returns a channel receiving every state transition and a function
+// that unsubscribes and closes the channel.
+func (s *Server) Subscribe() (<-chan Transition, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Transition, subscriberBuffer)
+	if s.subscribers == nil {
+		s.subscribers = map[chan Transition]struct{}{}
+	}
+	s.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// setState moves to a new state and notifies subscribers. Callers must hold s.mu.
+func (s *Server) setState(to State, exit *ExitStatus) {
+	if s.state == to {
+		return
+	}
+	t := Transition{From: s.state, To: to, Time: time.Now(), Exit: exit}
+	s.state = to
+	for ch := range s.subscribers {
+		select {
+		case ch <- t:
+		default:
+		}
+	}
+}
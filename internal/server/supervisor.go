@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RestartPolicy controls when the supervisor restarts an exited FrankenPHP process
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartNever     RestartPolicy = "never"
+)
+
+// ParseRestartPolicy validates a restart policy name
+func ParseRestartPolicy(name string) (RestartPolicy, error) {
+	switch p := RestartPolicy(name); p {
+	case RestartAlways, RestartOnFailure, RestartNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown restart policy %q (want always, on-failure or never)", name)
+	}
+}
+
+// RestartOptions configures the FrankenPHP supervisor
+type RestartOptions struct {
+	Policy RestartPolicy
+	// MaxRestarts is the number of consecutive quick restarts allowed before
+	// the supervisor gives up (crash loop). Zero means no limit.
+	MaxRestarts int
+	// InitialBackoff is the delay before the first restart; it doubles on
+	// each consecutive restart up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// ResetAfter is how long a process must stay up for the restart counter
+	// and backoff to reset.
+	ResetAfter time.Duration
+}
+
+// DefaultRestartOptions returns the supervisor defaults
+func DefaultRestartOptions() RestartOptions {
+	return RestartOptions{
+		Policy:         RestartOnFailure,
+		MaxRestarts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		ResetAfter:     time.Minute,
+	}
+}
+
+func (o RestartOptions) shouldRestart(exit *ExitStatus) bool {
+	switch o.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exit.Code != 0
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the given (1-based) consecutive restart
+func (o RestartOptions) backoff(attempt int) time.Duration {
+	delay := o.InitialBackoff
+	for i := 1; i < attempt && delay < o.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if o.MaxBackoff > 0 && delay > o.MaxBackoff {
+		delay = o.MaxBackoff
+	}
+	return delay
+}
+
+// ExitStatus records how a FrankenPHP process ended
+type ExitStatus struct {
+	Code       int // -1 if killed by a signal or never started
+	Error      string
+	StderrTail []string
+	Time       time.Time
+}
+
+func (e *ExitStatus) String() string {
+	if e.Error == "" {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Error
+}
+
+func newExitStatus(err error, tail *tailBuffer) *ExitStatus {
+	exit := &ExitStatus{Time: time.Now()}
+	if tail != nil {
+		exit.StderrTail = tail.Lines()
+	}
+	// *exec.ExitError, or the runner.ExitError of a fake process
+	var exitErr interface{ ExitCode() int }
+	switch {
+	case err == nil:
+		exit.Code = 0
+	case errors.As(err, &exitErr):
+		exit.Code = exitErr.ExitCode()
+		exit.Error = err.Error()
+	default:
+		exit.Code = -1
+		exit.Error = err.Error()
+	}
+	return exit
+}
+
+// supervise waits for proc to become ready and restarts it according to the
+// restart policy until stop is closed or the crash-loop limit is reached. The
+// outcome of the initial start is sent on ready; a process that fails its
+// initial readiness check is not restarted. It closes done when it returns.
+func (s *Server) supervise(proc *process, stop, done chan struct{}, ready chan<- error, opts RestartOptions) {
+	defer close(done)
+
+	failures := 0
+	for {
+		started := time.Now()
+		readyErr := s.waitReady(proc, stop)
+		if readyErr == nil {
+			s.mu.Lock()
+			if !isClosed(stop) {
+				s.setState(StateRunning, nil)
+			}
+			s.mu.Unlock()
+			if ready != nil {
+				ready <- nil
+				ready = nil
+			}
+		} else if !isClosed(stop) {
+			// Never became ready; make sure it is gone before deciding what to do
+			proc.signal(os.Kill)
+		}
+		// Stop terminates the process itself when stop is closed
+		<-proc.exited
+		exit := proc.exit
+
+		s.mu.Lock()
+		s.lastExit = exit
+		if isClosed(stop) {
+			// Requested by Stop
+			s.setState(StateStopped, exit)
+			s.mu.Unlock()
+			if ready != nil {
+				ready <- errStoppedStarting
+			}
+			return
+		}
+		if ready != nil {
+			s.setState(StateCrashed, exit)
+			s.mu.Unlock()
+			ready <- startupError(readyErr, exit)
+			return
+		}
+		if exit.Code == 0 {
+			s.setState(StateStopped, exit)
+		} else {
+			s.setState(StateCrashed, exit)
+		}
+		s.mu.Unlock()
+		if readyErr != nil {
+			s.log.Error("FrankenPHP failed to become ready", "err", readyErr)
+		} else {
+			s.log.Warn("FrankenPHP exited", "exit", exit.String(), "code", exit.Code)
+		}
+
+		if !opts.shouldRestart(exit) {
+			return
+		}
+		if time.Since(started) >= opts.ResetAfter {
+			failures = 0
+		}
+
+		for {
+			failures++
+			if opts.MaxRestarts > 0 && failures > opts.MaxRestarts {
+				s.log.Error("FrankenPHP keeps exiting; giving up", "restarts", failures-1)
+				s.mu.Lock()
+				s.setState(StateCrashed, s.lastExit)
+				s.mu.Unlock()
+				return
+			}
+
+			delay := opts.backoff(failures)
+			s.log.Info("restarting FrankenPHP", "delay", delay, "attempt", failures)
+			s.mu.Lock()
+			if !isClosed(stop) {
+				s.setState(StateStarting, nil)
+			}
+			s.mu.Unlock()
+
+			select {
+			case <-stop:
+				s.mu.Lock()
+				s.setState(StateStopped, nil)
+				s.mu.Unlock()
+				return
+			case <-time.After(delay):
+			}
+
+			// Relaunch under the lock so a concurrent Stop sees the new process
+			s.mu.Lock()
+			if isClosed(stop) {
+				s.setState(StateStopped, nil)
+				s.mu.Unlock()
+				return
+			}
+			var err error
+			proc, err = s.launch()
+			if err == nil {
+				s.proc = proc
+				s.restarts++
+				s.mu.Unlock()
+				break
+			}
+			s.lastExit = newExitStatus(err, nil)
+			s.setState(StateCrashed, s.lastExit)
+			s.mu.Unlock()
+			s.log.Error("failed to restart FrankenPHP", "err", err)
+		}
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// tailBuffer keeps the last few lines written to it
+type tailBuffer struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		t.push(strings.TrimRight(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	t.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (t *tailBuffer) push(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the buffered lines, including any unterminated last line
+func (t *tailBuffer) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, string(t.partial))
+	}
+	return lines
+}
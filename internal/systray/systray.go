@@ -2,23 +2,30 @@ package systray
 
 import (
 	"fmt"
-	"os/exec"
-	"runtime"
-	
+	"log/slog"
+
+	"github.com/4nkitd/miner/internal/browser"
+	"github.com/4nkitd/miner/internal/logging"
+	"github.com/4nkitd/miner/internal/runner"
+	"github.com/4nkitd/miner/internal/server"
 	"github.com/getlantern/systray"
 )
 
 type App struct {
 	server      ServerInterface
-	hosts       HostsInterface
-	cli         CLIInterface
+	uninstaller UninstallerInterface
 	service     ServiceInterface
 	cfg         ConfigInterface
 	menuItems   *MenuItems
+	unsubscribe func()
+	log         *slog.Logger
+	ownsServer  bool // stop the server when the tray quits
 }
 
 type MenuItems struct {
+	status      *systray.MenuItem
 	openAdminer *systray.MenuItem
+	viewLogs    *systray.MenuItem
 	startStop   *systray.MenuItem
 	autoStart   *systray.MenuItem
 	uninstall   *systray.MenuItem
@@ -28,17 +35,15 @@ type ServerInterface interface {
 	Start() error
 	Stop() error
 	IsRunning() bool
+	State() server.State
+	Status() server.Status
+	Subscribe() (<-chan server.Transition, func())
 	URL() string
 }
 
-type HostsInterface interface {
-	AddEntry(domain, ip string) error
-	RemoveEntry(domain string) error
-}
-
-type CLIInterface interface {
-	Register() error
-	Unregister() error
+// UninstallerInterface reverts the changes recorded by `miner install`
+type UninstallerInterface interface {
+	Uninstall() error
 }
 
 type ServiceInterface interface {
@@ -49,18 +54,26 @@ type ServiceInterface interface {
 
 type ConfigInterface interface {
 	URL() string
+	LogFile() string
 }
 
-func NewApp(server ServerInterface, hosts HostsInterface, cli CLIInterface, service ServiceInterface, cfg ConfigInterface) *App {
+func NewApp(server ServerInterface, uninstaller UninstallerInterface, service ServiceInterface, cfg ConfigInterface, logger *slog.Logger) *App {
 	return &App{
-		server:  server,
-		hosts:   hosts,
-		cli:     cli,
-		service: service,
-		cfg:     cfg,
+		server:      server,
+		uninstaller: uninstaller,
+		service:     service,
+		cfg:         cfg,
+		log:         logging.OrDefault(logger),
+		ownsServer:  true,
 	}
 }
 
+// SetOwnsServer controls whether quitting the tray stops the server. A tray
+// attached to an instance running in another process leaves it running.
+func (a *App) SetOwnsServer(owns bool) {
+	a.ownsServer = owns
+}
+
 func (a *App) Run() {
 	systray.Run(a.onReady, a.onExit)
 }
@@ -71,7 +84,10 @@ func (a *App) onReady() {
 	
 	a.menuItems = &MenuItems{}
 	
+	a.menuItems.status = systray.AddMenuItem("Status: starting", "FrankenPHP status")
+	a.menuItems.status.Disable()
 	a.menuItems.openAdminer = systray.AddMenuItem("Open Adminer", "Open Adminer in browser")
+	a.menuItems.viewLogs = systray.AddMenuItem("View Logs", "Open the FrankenPHP log file")
 	systray.AddSeparator()
 	a.menuItems.startStop = systray.AddMenuItem("Stop Server", "Stop the Adminer server")
 	a.menuItems.autoStart = systray.AddMenuItemCheckbox("Auto-start on Boot", "Start Miner automatically", true)
@@ -79,7 +95,46 @@ func (a *App) onReady() {
 	a.menuItems.uninstall = systray.AddMenuItem("Uninstall", "Remove Miner configuration")
 	mQuit := systray.AddMenuItem("Quit", "Quit Miner")
 	
+	transitions, unsubscribe := a.server.Subscribe()
+	a.unsubscribe = unsubscribe
+	a.refreshStatus()
 	go a.handleEvents(mQuit)
+	go a.watchState(transitions)
+}
+
+// watchState keeps the menu in sync with the supervised server, which may
+// crash or be restarted without any menu interaction.
+func (a *App) watchState(transitions <-chan server.Transition) {
+	for range transitions {
+		a.refreshStatus()
+	}
+}
+
+func (a *App) refreshStatus() {
+	st := a.server.Status()
+	switch st.State {
+	case server.StateStarting, server.StateStopping:
+		a.menuItems.startStop.Disable()
+	case server.StateRunning:
+		a.menuItems.startStop.SetTitle("Stop Server")
+		a.menuItems.startStop.Enable()
+	default:
+		a.menuItems.startStop.SetTitle("Start Server")
+		a.menuItems.startStop.Enable()
+	}
+	a.menuItems.status.SetTitle(statusText(st))
+}
+
+// statusText summarises the server status for the menu
+func statusText(st server.Status) string {
+	switch {
+	case st.State == server.StateRunning && st.Restarts > 0:
+		return fmt.Sprintf("Status: running (restarted %d times)", st.Restarts)
+	case st.State == server.StateCrashed && st.LastExit != nil:
+		return fmt.Sprintf("Status: crashed (%s)", st.LastExit)
+	default:
+		return "Status: " + string(st.State)
+	}
 }
 
 func (a *App) handleEvents(mQuit *systray.MenuItem) {
@@ -87,6 +142,8 @@ func (a *App) handleEvents(mQuit *systray.MenuItem) {
 		select {
 		case <-a.menuItems.openAdminer.ClickedCh:
 			a.openBrowser()
+		case <-a.menuItems.viewLogs.ClickedCh:
+			a.openLogs()
 		case <-a.menuItems.startStop.ClickedCh:
 			a.toggleServer()
 		case <-a.menuItems.autoStart.ClickedCh:
@@ -101,38 +158,36 @@ func (a *App) handleEvents(mQuit *systray.MenuItem) {
 }
 
 func (a *App) openBrowser() {
+	// The server URL reflects the fallback port if one was chosen
 	url := a.cfg.URL()
-	var cmd *exec.Cmd
-	
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("open", url)
-	case "windows":
-		cmd = exec.Command("cmd", "/c", "start", url)
-	default:
-		cmd = exec.Command("xdg-open", url)
+	if a.server.IsRunning() {
+		url = a.server.URL()
 	}
-	
-	if err := cmd.Start(); err != nil {
-		fmt.Printf("Failed to open browser: %v\n", err)
+
+	if err := browser.Open(runner.Exec{}, url); err != nil {
+		a.log.Error("failed to open browser", "url", url, "err", err)
+	}
+}
+
+func (a *App) openLogs() {
+	if err := browser.Open(runner.Exec{}, a.cfg.LogFile()); err != nil {
+		a.log.Error("failed to open log file", "path", a.cfg.LogFile(), "err", err)
 	}
 }
 
 func (a *App) toggleServer() {
 	if a.server.IsRunning() {
 		if err := a.server.Stop(); err != nil {
-			fmt.Printf("Failed to stop server: %v\n", err)
+			a.log.Error("failed to stop server", "err", err)
 			return
 		}
-		a.menuItems.startStop.SetTitle("Start Server")
-		fmt.Println("Server stopped")
+		a.log.Info("server stopped")
 	} else {
 		if err := a.server.Start(); err != nil {
-			fmt.Printf("Failed to start server: %v\n", err)
+			a.log.Error("failed to start server", "err", err)
 			return
 		}
-		a.menuItems.startStop.SetTitle("Stop Server")
-		fmt.Println("Server started")
+		a.log.Info("server started")
 	}
 }
 
@@ -140,46 +195,42 @@ func (a *App) toggleAutoStart() {
 	if a.menuItems.autoStart.Checked() {
 		a.menuItems.autoStart.Uncheck()
 		if err := a.service.Uninstall(); err != nil {
-			fmt.Printf("Failed to disable auto-start: %v\n", err)
+			a.log.Error("failed to disable auto-start", "err", err)
 		} else {
-			fmt.Println("Auto-start disabled")
+			a.log.Info("auto-start disabled")
 		}
 	} else {
 		a.menuItems.autoStart.Check()
 		if err := a.service.Install(); err != nil {
-			fmt.Printf("Failed to enable auto-start: %v\n", err)
+			a.log.Error("failed to enable auto-start", "err", err)
 		} else {
-			fmt.Println("Auto-start enabled")
+			a.log.Info("auto-start enabled")
 		}
 	}
 }
 
 func (a *App) uninstall() {
-	fmt.Println("Uninstalling Miner...")
+	a.log.Info("uninstalling Miner")
 	
 	if err := a.server.Stop(); err != nil {
-		fmt.Printf("Warning: Failed to stop server: %v\n", err)
-	}
-	
-	if err := a.hosts.RemoveEntry("miner.local"); err != nil {
-		fmt.Printf("Warning: Failed to remove hosts entry: %v\n", err)
-	}
-	
-	if err := a.cli.Unregister(); err != nil {
-		fmt.Printf("Warning: Failed to unregister CLI commands: %v\n", err)
+		a.log.Warn("failed to stop server", "err", err)
 	}
 	
-	if err := a.service.Uninstall(); err != nil {
-		fmt.Printf("Warning: Failed to uninstall service: %v\n", err)
+	if err := a.uninstaller.Uninstall(); err != nil {
+		a.log.Error("failed to uninstall Miner", "err", err)
+		return
 	}
 	
-	fmt.Println("Miner uninstalled successfully")
+	a.log.Info("Miner uninstalled")
 	systray.Quit()
 }
 
 func (a *App) onExit() {
-	if a.server != nil && a.server.IsRunning() {
+	if a.unsubscribe != nil {
+		a.unsubscribe()
+	}
+	if a.ownsServer && a.server != nil && a.server.IsRunning() {
 		a.server.Stop()
 	}
-	fmt.Println("Miner exited")
+	a.log.Info("Miner exited")
 }
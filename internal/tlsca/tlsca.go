@@ -0,0 +1,198 @@
+package tlsca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File names inside the certificate directory
+const (
+	CAFile    = "ca.pem"
+	CAKeyFile = "ca-key.pem"
+	CertFile  = "cert.pem"
+	KeyFile   = "key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 825 * 24 * time.Hour // maximum accepted by Apple platforms
+	renewBefore  = 30 * 24 * time.Hour
+)
+
+// EnsureCA creates the local root CA in dir unless it already exists and
+// returns the path of the CA certificate.
+func EnsureCA(dir string) (string, error) {
+	caPath := filepath.Join(dir, CAFile)
+	if _, _, err := loadCA(dir); err == nil {
+		return caPath, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create certificate dir: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{Organization: []string{"Miner"}, CommonName: "Miner Local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	// The CA key never leaves this directory and is readable by its owner only
+	if err := writeKey(filepath.Join(dir, CAKeyFile), key, 0600); err != nil {
+		return "", err
+	}
+	if err := writePEM(caPath, "CERTIFICATE", der, 0644); err != nil {
+		return "", err
+	}
+	return caPath, nil
+}
+
+// EnsureLeaf returns a certificate and key for hosts signed by the local CA
+// in dir, creating the CA and (re)issuing the leaf when it is missing, does
+// not cover all hosts or is about to expire.
+func EnsureLeaf(dir string, hosts []string) (string, string, error) {
+	certPath := filepath.Join(dir, CertFile)
+	keyPath := filepath.Join(dir, KeyFile)
+	if leafValid(certPath, keyPath, hosts) {
+		return certPath, keyPath, nil
+	}
+
+	if _, err := EnsureCA(dir); err != nil {
+		return "", "", err
+	}
+	caCert, caKey, err := loadCA(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load local CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{Organization: []string{"Miner"}, CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	// FrankenPHP may run as a different user than the one who created the
+	// certificate (tray vs. service), so the leaf key is world-readable
+	if err := writeKey(keyPath, key, 0644); err != nil {
+		return "", "", err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// leafValid reports whether the leaf in dir covers hosts and is not expiring
+func leafValid(certPath, keyPath string, hosts []string) bool {
+	if _, err := os.Stat(keyPath); err != nil {
+		return false
+	}
+	cert, err := readCert(certPath)
+	if err != nil || time.Until(cert.NotAfter) < renewBefore {
+		return false
+	}
+	for _, h := range hosts {
+		if cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func loadCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	cert, err := readCert(filepath.Join(dir, CAFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("invalid CA key in %s", dir)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CA key in %s: %w", dir, err)
+	}
+	return cert, key, nil
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid certificate in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey, perm os.FileMode) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, perm)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file; enforce ours
+	return os.Chmod(path, perm)
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return n
+}
@@ -0,0 +1,36 @@
+//go:build darwin
+// +build darwin
+
+package tlsca
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+const systemKeychain = "/Library/Keychains/System.keychain"
+
+// Trust adds the CA certificate to the system keychain with the security
+// tool started by r (requires root)
+func Trust(r runner.Runner, caPath string) error {
+	return run(r, "security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", systemKeychain, caPath)
+}
+
+// Untrust removes the CA certificate from the system keychain with the
+// security tool started by r (requires root)
+func Untrust(r runner.Runner, caPath string) error {
+	if _, err := os.Stat(caPath); err == nil {
+		_ = run(r, "security", "remove-trusted-cert", "-d", caPath)
+	}
+	return run(r, "security", "delete-certificate", "-c", "Miner Local CA", systemKeychain)
+}
+
+func run(r runner.Runner, name string, args ...string) error {
+	cmd := &runner.Cmd{Path: name, Args: args, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := runner.Run(r, cmd); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+package tlsca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// trustStore is a distribution-specific CA anchor directory
+type trustStore struct {
+	dir     string
+	file    string
+	refresh []string
+}
+
+// trustStores lists the anchor directories of common distributions
+var trustStores = []trustStore{
+	{"/usr/local/share/ca-certificates", "miner-local-ca.crt", []string{"update-ca-certificates"}},           // Debian, Ubuntu, Alpine
+	{"/etc/pki/ca-trust/source/anchors", "miner-local-ca.pem", []string{"update-ca-trust", "extract"}},       // Fedora, RHEL
+	{"/etc/ca-certificates/trust-source/anchors", "miner-local-ca.crt", []string{"trust", "extract-compat"}}, // Arch
+}
+
+// Trust adds the CA certificate to the system trust store and refreshes it
+// with the tool started by r (requires root)
+func Trust(r runner.Runner, caPath string) error {
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	for _, store := range trustStores {
+		if _, err := os.Stat(store.dir); err != nil {
+			continue
+		}
+		refresh, err := r.LookPath(store.refresh[0])
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(store.dir, store.file), data, 0644); err != nil {
+			return fmt.Errorf("failed to install CA certificate: %w", err)
+		}
+		return run(r, refresh, store.refresh[1:]...)
+	}
+	// p11-kit based systems without a known anchor directory
+	if trust, err := r.LookPath("trust"); err == nil {
+		return run(r, trust, "anchor", "--store", caPath)
+	}
+	return fmt.Errorf("no supported system trust store found (update-ca-certificates, update-ca-trust or trust)")
+}
+
+// Untrust removes the CA certificate from the system trust store and
+// refreshes it with the tool started by r (requires root)
+func Untrust(r runner.Runner, caPath string) error {
+	removed := false
+	for _, store := range trustStores {
+		path := filepath.Join(store.dir, store.file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove CA certificate: %w", err)
+		}
+		removed = true
+		if err := run(r, store.refresh[0], store.refresh[1:]...); err != nil {
+			return err
+		}
+	}
+	if !removed {
+		if trust, err := r.LookPath("trust"); err == nil {
+			if _, err := os.Stat(caPath); err == nil {
+				return run(r, trust, "anchor", "--remove", caPath)
+			}
+		}
+	}
+	return nil
+}
+
+func run(r runner.Runner, name string, args ...string) error {
+	cmd := &runner.Cmd{Path: name, Args: args, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := runner.Run(r, cmd); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
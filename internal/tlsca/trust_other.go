@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package tlsca
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/4nkitd/miner/internal/runner"
+)
+
+// Trust is not supported on this platform; import the CA certificate manually
+func Trust(r runner.Runner, caPath string) error {
+	return fmt.Errorf("adding the CA to the trust store is not supported on %s; import %s manually", runtime.GOOS, caPath)
+}
+
+// Untrust is not supported on this platform
+func Untrust(r runner.Runner, caPath string) error {
+	return fmt.Errorf("removing the CA from the trust store is not supported on %s", runtime.GOOS)
+}